@@ -45,7 +45,7 @@ func main() {
 		dataPath = sqlDb
 	}
 
-	err = DbMigration(dataPath, &models.GORMSession{}, &models.GORMUser{})
+	err = DbMigration(dataPath, &models.GORMSession{}, &models.GORMUser{}, &models.GORMMessage{}, &models.GORMStreamToken{})
 	if err != nil {
 		fmt.Printf("Error: %s\n", err.Error())
 		return
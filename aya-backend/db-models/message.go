@@ -0,0 +1,88 @@
+package models
+
+import (
+	"aya-backend/server-ws/chat_service"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type GORMMessage struct {
+	gorm.Model
+	SessionUUID uuid.UUID `gorm:"index"`
+	Source      string
+	MessageId   string `gorm:"index"`
+	// Message is the JSON of the whole message, Reaction the JSON of the reaction change, if any
+	Message  string
+	Reaction string
+	// ExtraFields is the JSON of the resource info of the message, if any
+	ExtraFields string
+	Update      string
+	UpdateTime  time.Time `gorm:"index"`
+}
+
+func NewGORMMessage(sessionUUID uuid.UUID, msg chat_service.MessageUpdate) (*GORMMessage, error) {
+	message, err := json.Marshal(msg.Message)
+	if err != nil {
+		return nil, err
+	}
+	gormMessage := GORMMessage{
+		SessionUUID: sessionUUID,
+		Source:      msg.Message.Source.String(),
+		MessageId:   msg.Message.Id,
+		Message:     string(message),
+		Update:      msg.Update.String(),
+		UpdateTime:  msg.UpdateTime,
+	}
+	if msg.Reaction != nil {
+		reaction, err := json.Marshal(msg.Reaction)
+		if err != nil {
+			return nil, err
+		}
+		gormMessage.Reaction = string(reaction)
+	}
+	if msg.ExtraFields != nil {
+		extraFields, err := json.Marshal(msg.ExtraFields)
+		if err != nil {
+			return nil, err
+		}
+		gormMessage.ExtraFields = string(extraFields)
+	}
+	return &gormMessage, nil
+}
+
+// MessageUpdate converts the stored row back to the update that was sent to the session
+func (message *GORMMessage) MessageUpdate() (chat_service.MessageUpdate, error) {
+	var msgUpdate chat_service.MessageUpdate
+	var err error
+
+	if msgUpdate.Update, err = chat_service.ParseUpdate(message.Update); err != nil {
+		return msgUpdate, err
+	}
+	if err = json.Unmarshal([]byte(message.Message), &msgUpdate.Message); err != nil {
+		return msgUpdate, err
+	}
+	if msgUpdate.Message.Source, err = chat_service.ParseSource(message.Source); err != nil {
+		return msgUpdate, err
+	}
+	if message.Reaction != "" {
+		msgUpdate.Reaction = &chat_service.ReactionChange{}
+		if err = json.Unmarshal([]byte(message.Reaction), msgUpdate.Reaction); err != nil {
+			return msgUpdate, err
+		}
+	}
+	if message.ExtraFields != "" {
+		plugin, ok := chat_service.GetSourcePlugin(msgUpdate.Message.Source)
+		if !ok {
+			return msgUpdate, fmt.Errorf("source '%s' is not supported", msgUpdate.Message.Source)
+		}
+		if msgUpdate.ExtraFields, err = plugin.DecodeResourceInfo([]byte(message.ExtraFields)); err != nil {
+			return msgUpdate, err
+		}
+	}
+	msgUpdate.Message.Id = message.MessageId
+	msgUpdate.UpdateTime = message.UpdateTime
+	return msgUpdate, nil
+}
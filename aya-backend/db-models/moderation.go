@@ -0,0 +1,66 @@
+package models
+
+import (
+	"aya-backend/server-ws/chat_service"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+type Role string
+
+const (
+	RoleEveryone    Role = ""
+	RoleSubscriber  Role = "subscriber"
+	RoleVip         Role = "vip"
+	RoleModerator   Role = "moderator"
+	RoleBroadcaster Role = "broadcaster"
+)
+
+var (
+	// roles from the lowest to the highest
+	roleOrder = []Role{RoleEveryone, RoleSubscriber, RoleVip, RoleModerator, RoleBroadcaster}
+)
+
+// Rank returns the position of the role in the role hierarchy, or -1 if the role is unknown
+func (role Role) Rank() int {
+	return slices.Index(roleOrder, role)
+}
+
+// ModerationRules are the rules a session owner sets to hide messages from the session
+type ModerationRules struct {
+	// BannedWords are matched as whole words, ignoring the case
+	BannedWords   []string `json:"bannedWords,omitempty"`
+	BannedRegexes []string `json:"bannedRegexes,omitempty"`
+	// BlockedAuthors are the ids or usernames of the blocked authors of each source
+	BlockedAuthors map[chat_service.Source][]string `json:"blockedAuthors,omitempty"`
+	HideBots       bool                             `json:"hideBots,omitempty"`
+	HideLinks      bool                             `json:"hideLinks,omitempty"`
+	// MinimumRole is the lowest role an author needs for their messages to be shown
+	MinimumRole Role `json:"minimumRole,omitempty"`
+}
+
+func (rules *ModerationRules) Validate() error {
+	for _, bannedRegex := range rules.BannedRegexes {
+		if _, err := regexp.Compile(bannedRegex); err != nil {
+			return fmt.Errorf("invalid banned regex \"%s\": %s", bannedRegex, err.Error())
+		}
+	}
+	if rules.MinimumRole.Rank() == -1 {
+		return fmt.Errorf("unknown role \"%s\"", rules.MinimumRole)
+	}
+	return nil
+}
+
+// ParseModerationRules reads the rules stored on a session. Sessions without rules show every message.
+func ParseModerationRules(rulesStr string) (ModerationRules, error) {
+	var rules ModerationRules
+	if rulesStr == "" {
+		return rules, nil
+	}
+	if err := json.Unmarshal([]byte(rulesStr), &rules); err != nil {
+		return rules, err
+	}
+	return rules, rules.Validate()
+}
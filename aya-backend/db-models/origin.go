@@ -0,0 +1,76 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// AnyOrigin is the origin pattern that matches every origin
+const AnyOrigin = "*"
+
+// splitOrigin splits an origin, or an origin pattern, into its lowercase scheme and host
+func splitOrigin(origin string) (string, string, bool) {
+	scheme, host, ok := strings.Cut(strings.ToLower(strings.TrimSpace(origin)), "://")
+	if !ok || scheme == "" || host == "" {
+		return "", "", false
+	}
+	return scheme, host, true
+}
+
+// ValidateOriginPattern checks an origin pattern, which is either "*", an origin such as
+// "https://example.com:8080", or an origin whose host starts with a wildcard label such
+// as "https://*.example.com", matching the subdomains of example.com
+func ValidateOriginPattern(pattern string) error {
+	if pattern == AnyOrigin {
+		return nil
+	}
+	_, host, ok := splitOrigin(pattern)
+	if !ok {
+		return fmt.Errorf("origin \"%s\" must be a scheme and a host", pattern)
+	}
+	if strings.ContainsAny(host, "/?#@") {
+		return fmt.Errorf("origin \"%s\" must not have a path", pattern)
+	}
+	if strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+		return fmt.Errorf("origin \"%s\" can only have a wildcard as its first label", pattern)
+	}
+	return nil
+}
+
+// MatchOrigin checks whether the origin sent by a browser matches the pattern
+func MatchOrigin(pattern string, origin string) bool {
+	if pattern == AnyOrigin {
+		return true
+	}
+	patternScheme, patternHost, ok := splitOrigin(pattern)
+	if !ok {
+		return false
+	}
+	scheme, host, ok := splitOrigin(origin)
+	if !ok || scheme != patternScheme {
+		return false
+	}
+	if subdomain, ok := strings.CutPrefix(patternHost, "*"); ok {
+		return len(host) > len(subdomain) && strings.HasSuffix(host, subdomain)
+	}
+	return host == patternHost
+}
+
+// ParseAllowedOrigins reads the origin patterns stored on a session. Sessions without
+// patterns can be embedded by every origin allowed by the server.
+func ParseAllowedOrigins(originsStr string) ([]string, error) {
+	if originsStr == "" {
+		return nil, nil
+	}
+	var origins []string
+	if err := json.Unmarshal([]byte(originsStr), &origins); err != nil {
+		return nil, err
+	}
+	for _, origin := range origins {
+		if err := ValidateOriginPattern(origin); err != nil {
+			return nil, err
+		}
+	}
+	return origins, nil
+}
@@ -0,0 +1,73 @@
+package models
+
+import "testing"
+
+func TestValidateOriginPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		valid   bool
+	}{
+		{pattern: "*", valid: true},
+		{pattern: "https://example.com", valid: true},
+		{pattern: "http://localhost:3000", valid: true},
+		{pattern: "https://*.example.com", valid: true},
+		{pattern: "https://*.example.com:8080", valid: true},
+		{pattern: "example.com", valid: false},
+		{pattern: "https://", valid: false},
+		{pattern: "://example.com", valid: false},
+		{pattern: "https://example.com/path", valid: false},
+		{pattern: "https://example.com?query", valid: false},
+		{pattern: "https://user@example.com", valid: false},
+		{pattern: "https://a.*.example.com", valid: false},
+		{pattern: "https://*example.com", valid: false},
+		{pattern: "https://*.*.example.com", valid: false},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			err := ValidateOriginPattern(test.pattern)
+			if (err == nil) != test.valid {
+				t.Errorf("ValidateOriginPattern(%q) = %v, want valid %t", test.pattern, err, test.valid)
+			}
+		})
+	}
+}
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern string
+		origin  string
+		match   bool
+	}{
+		{pattern: "*", origin: "https://anything.com", match: true},
+		{pattern: "https://example.com", origin: "https://example.com", match: true},
+		{pattern: "https://example.com", origin: "HTTPS://Example.COM", match: true},
+		{pattern: "https://example.com", origin: "http://example.com", match: false},
+		{pattern: "https://example.com", origin: "https://example.com:8080", match: false},
+		{pattern: "https://example.com", origin: "https://a.example.com", match: false},
+		{pattern: "http://localhost:3000", origin: "http://localhost:3000", match: true},
+		{pattern: "http://localhost:3000", origin: "http://localhost:3001", match: false},
+
+		// wildcards
+		{pattern: "https://*.example.com", origin: "https://a.example.com", match: true},
+		{pattern: "https://*.example.com", origin: "https://a.b.example.com", match: true},
+		{pattern: "https://*.example.com", origin: "https://example.com", match: false},
+		{pattern: "https://*.example.com", origin: "https://.example.com", match: false},
+		{pattern: "https://*.example.com", origin: "https://evil-example.com", match: false},
+		{pattern: "https://*.example.com", origin: "https://evilexample.com", match: false},
+		{pattern: "https://*.example.com", origin: "https://a.example.com.evil.com", match: false},
+		{pattern: "https://*.example.com", origin: "http://a.example.com", match: false},
+		{pattern: "https://*.example.com", origin: "https://a.example.com:8080", match: false},
+		{pattern: "https://*.example.com:8080", origin: "https://a.example.com:8080", match: true},
+
+		// malformed origins
+		{pattern: "https://example.com", origin: "example.com", match: false},
+		{pattern: "https://example.com", origin: "null", match: false},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.origin, func(t *testing.T) {
+			if match := MatchOrigin(test.pattern, test.origin); match != test.match {
+				t.Errorf("MatchOrigin(%q, %q) = %t, want %t", test.pattern, test.origin, match, test.match)
+			}
+		})
+	}
+}
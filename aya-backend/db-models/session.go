@@ -2,9 +2,7 @@ package models
 
 import (
 	"aya-backend/server-ws/chat_service"
-	discordsource "aya-backend/server-ws/chat_service/discord"
-	twitchsource "aya-backend/server-ws/chat_service/twitch"
-	youtubesource "aya-backend/server-ws/chat_service/youtube"
+	_ "aya-backend/server-ws/chat_service/sources"
 	"encoding/json"
 	"fmt"
 	"github.com/google/uuid"
@@ -15,9 +13,13 @@ type GORMSession struct {
 	gorm.Model
 	UUID      uuid.UUID
 	Resources string
-	IsOn      bool
-	UserID    uint
-	User      GORMUser `gorm:"references:ID"`
+	// ModerationRules is the JSON of the ModerationRules of the session
+	ModerationRules string
+	// AllowedOrigins is the JSON list of the origin patterns that can embed the stream of the session
+	AllowedOrigins string
+	IsOn           bool
+	UserID         uint
+	User           GORMUser `gorm:"references:ID"`
 }
 
 type Resource struct {
@@ -41,37 +43,29 @@ func (r *Resource) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	switch r.ResourceType {
-	case chat_service.Discord:
-		var discordInfo discordsource.DiscordInfo
-		err := json.Unmarshal(resourceInfoStr, &discordInfo)
-		if err != nil {
-			return fmt.Errorf("resource of type 'discord', but cannot parse the info: %s", err.Error())
-		} else {
-			r.ResourceInfo = discordInfo
-			return nil
-		}
-	case chat_service.Youtube:
-		var youtubeInfo youtubesource.YoutubeInfo
-		err := json.Unmarshal(resourceInfoStr, &youtubeInfo)
-		if err != nil {
-			return fmt.Errorf("resource of type 'youtube', but cannot parse the info: %s", err.Error())
-		} else {
-			r.ResourceInfo = youtubeInfo
-			return nil
-		}
-	case chat_service.Twitch:
-		var twitchInfo twitchsource.TwitchInfo
-		err := json.Unmarshal(resourceInfoStr, &twitchInfo)
-		if err != nil {
-			return fmt.Errorf("resource of type 'twitch', but cannot parse the info: %s", err.Error())
-		} else {
-			r.ResourceInfo = twitchInfo
-			return nil
-		}
-	default:
+	plugin, ok := chat_service.GetSourcePlugin(r.ResourceType)
+	if !ok {
 		return fmt.Errorf("resource of type '%v' is not supported", r.ResourceType)
 	}
+	resourceInfo, err := plugin.DecodeResourceInfo(resourceInfoStr)
+	if err != nil {
+		return fmt.Errorf("resource of type '%s', but cannot parse the info: %s", r.ResourceType, err.Error())
+	}
+	r.ResourceInfo = resourceInfo
+	return nil
+}
+
+// Validate checks that the info of the resource is complete. It is not checked when the resource
+// is decoded, so that the sessions stored before a check was added can still be read.
+func (r *Resource) Validate() error {
+	plugin, ok := chat_service.GetSourcePlugin(r.ResourceType)
+	if !ok {
+		return fmt.Errorf("resource of type '%v' is not supported", r.ResourceType)
+	}
+	if err := plugin.ValidateResourceInfo(r.ResourceInfo); err != nil {
+		return fmt.Errorf("resource of type '%s', but the info is invalid: %s", r.ResourceType, err.Error())
+	}
+	return nil
 }
 
 func (session *GORMSession) BeforeCreate(db *gorm.DB) (err error) {
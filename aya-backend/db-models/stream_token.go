@@ -0,0 +1,80 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	// STREAM_TOKEN_SECRET_ENV is the HMAC secret shared by server-api, which signs the
+	// viewer tokens, and server-ws, which checks them
+	STREAM_TOKEN_SECRET_ENV = "STREAM_TOKEN_SECRET"
+	// INTERNAL_API_SECRET_ENV is the secret server-api sends to the internal endpoints of server-ws
+	INTERNAL_API_SECRET_ENV = "INTERNAL_API_SECRET"
+
+	STREAM_TOKEN_ISSUER = "aya"
+)
+
+var (
+	ErrStreamTokenSession = errors.New("token is not valid for this session")
+)
+
+// GORMStreamToken is a viewer token issued for a session. The token itself is not
+// stored, only what is needed to list and revoke it.
+type GORMStreamToken struct {
+	gorm.Model
+	// UUID is the id of the token, sent as the jti claim
+	UUID        uuid.UUID `gorm:"uniqueIndex"`
+	SessionUUID uuid.UUID `gorm:"index"`
+	Label       string
+	ExpiresAt   time.Time
+	RevokedAt   *time.Time
+}
+
+func (token *GORMStreamToken) BeforeCreate(db *gorm.DB) (err error) {
+	token.UUID = uuid.New()
+	return
+}
+
+// Sign returns the signed viewer token. It must be called after the token is created,
+// so that its id and creation time are set.
+func (token *GORMStreamToken) Sign(secret []byte) (string, error) {
+	claims := jwt.RegisteredClaims{
+		Issuer:    STREAM_TOKEN_ISSUER,
+		Subject:   token.SessionUUID.String(),
+		ID:        token.UUID.String(),
+		IssuedAt:  jwt.NewNumericDate(token.CreatedAt),
+		ExpiresAt: jwt.NewNumericDate(token.ExpiresAt),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+}
+
+// ParseStreamToken checks the signature and the expiry of the viewer token, and that
+// it was issued for the session. The revocation must be checked by the caller.
+func ParseStreamToken(secret []byte, tokenStr string, sessionId string) (*jwt.RegisteredClaims, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(
+		tokenStr,
+		&claims,
+		func(token *jwt.Token) (any, error) {
+			return secret, nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(STREAM_TOKEN_ISSUER),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject != sessionId {
+		return nil, ErrStreamTokenSession
+	}
+	if claims.ID == "" {
+		return nil, fmt.Errorf("token has no id")
+	}
+	return &claims, nil
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("test secret")
+
+func signTestClaims(t *testing.T, method jwt.SigningMethod, key any, claims jwt.RegisteredClaims) string {
+	t.Helper()
+	tokenStr, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenStr
+}
+
+func TestParseStreamToken(t *testing.T) {
+	sessionId := uuid.New().String()
+	validClaims := func() jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			Issuer:    STREAM_TOKEN_ISSUER,
+			Subject:   sessionId,
+			ID:        uuid.New().String(),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}
+	}
+
+	expired := validClaims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	noExpiry := validClaims()
+	noExpiry.ExpiresAt = nil
+	otherIssuer := validClaims()
+	otherIssuer.Issuer = "other"
+	noId := validClaims()
+	noId.ID = ""
+
+	tests := []struct {
+		name     string
+		tokenStr string
+		wantErr  error
+		// anyErr is set when the test only expects the token to be rejected
+		anyErr bool
+	}{
+		{name: "valid", tokenStr: signTestClaims(t, jwt.SigningMethodHS256, testSecret, validClaims())},
+		{name: "expired", tokenStr: signTestClaims(t, jwt.SigningMethodHS256, testSecret, expired), wantErr: jwt.ErrTokenExpired},
+		{name: "without expiry", tokenStr: signTestClaims(t, jwt.SigningMethodHS256, testSecret, noExpiry), anyErr: true},
+		{name: "wrong session", tokenStr: signTestClaims(t, jwt.SigningMethodHS256, testSecret, func() jwt.RegisteredClaims {
+			claims := validClaims()
+			claims.Subject = uuid.New().String()
+			return claims
+		}()), wantErr: ErrStreamTokenSession},
+		{name: "other issuer", tokenStr: signTestClaims(t, jwt.SigningMethodHS256, testSecret, otherIssuer), wantErr: jwt.ErrTokenInvalidIssuer},
+		{name: "without id", tokenStr: signTestClaims(t, jwt.SigningMethodHS256, testSecret, noId), anyErr: true},
+		{name: "other secret", tokenStr: signTestClaims(t, jwt.SigningMethodHS256, []byte("other secret"), validClaims()), wantErr: jwt.ErrTokenSignatureInvalid},
+		{name: "other algorithm", tokenStr: signTestClaims(t, jwt.SigningMethodHS512, testSecret, validClaims()), wantErr: jwt.ErrTokenSignatureInvalid},
+		{name: "unsigned", tokenStr: signTestClaims(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, validClaims()), anyErr: true},
+		{name: "malformed", tokenStr: "not a token", wantErr: jwt.ErrTokenMalformed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := ParseStreamToken(testSecret, test.tokenStr, sessionId)
+			switch {
+			case test.anyErr:
+				if err == nil {
+					t.Error("token was accepted")
+				}
+			case test.wantErr != nil:
+				if !errors.Is(err, test.wantErr) {
+					t.Errorf("err = %v, want %v", err, test.wantErr)
+				}
+			case err != nil:
+				t.Errorf("err = %v, want the token accepted", err)
+			case claims.Subject != sessionId:
+				t.Errorf("subject = %s, want %s", claims.Subject, sessionId)
+			}
+		})
+	}
+}
+
+func TestSignStreamToken(t *testing.T) {
+	token := GORMStreamToken{
+		UUID:        uuid.New(),
+		SessionUUID: uuid.New(),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+	token.CreatedAt = time.Now()
+	tokenStr, err := token.Sign(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ParseStreamToken(testSecret, tokenStr, token.SessionUUID.String())
+	if err != nil {
+		t.Fatalf("signed token is rejected: %s", err.Error())
+	}
+	if claims.ID != token.UUID.String() {
+		t.Errorf("id = %s, want %s", claims.ID, token.UUID.String())
+	}
+}
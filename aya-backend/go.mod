@@ -6,12 +6,15 @@ require (
 	github.com/MicahParks/keyfunc/v3 v3.3.2
 	github.com/bwmarrin/discordgo v0.27.1
 	github.com/fatih/color v1.16.0
+	github.com/fxamacker/cbor/v2 v2.9.4
+	github.com/gempir/go-twitch-irc/v4 v4.0.0
 	github.com/golang-jwt/jwt/v5 v5.2.1
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/mux v1.8.1
 	github.com/gorilla/schema v1.3.0
 	github.com/gorilla/websocket v1.5.1
 	github.com/joho/godotenv v1.5.1
+	github.com/vmihailenco/msgpack/v5 v5.4.1
 	golang.org/x/oauth2 v0.18.0
 	google.golang.org/api v0.172.0
 	gorm.io/driver/sqlite v1.5.5
@@ -23,7 +26,6 @@ require (
 	cloud.google.com/go/compute/metadata v0.2.3 // indirect
 	github.com/MicahParks/jwkset v0.5.17 // indirect
 	github.com/felixge/httpsnoop v1.0.4 // indirect
-	github.com/gempir/go-twitch-irc/v4 v4.0.0 // indirect
 	github.com/go-logr/logr v1.4.1 // indirect
 	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
@@ -36,6 +38,8 @@ require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-sqlite3 v1.14.17 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	go.opencensus.io v0.24.0 // indirect
 	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.49.0 // indirect
 	go.opentelemetry.io/otel v1.24.0 // indirect
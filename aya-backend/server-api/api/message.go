@@ -0,0 +1,159 @@
+package api
+
+import (
+	models "aya-backend/db-models"
+	"aya-backend/server-ws/chat_service"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_MESSAGES_LIMIT = 100
+	MAX_MESSAGES_LIMIT     = 500
+)
+
+type MessageFilter struct {
+	SessionFilter
+	From   *string `json:"from,omitempty" schema:"from"`
+	To     *string `json:"to,omitempty" schema:"to"`
+	Cursor *uint   `json:"cursor,omitempty" schema:"cursor"`
+	Limit  *int    `json:"limit,omitempty" schema:"limit"`
+}
+
+type ArchivedMessage struct {
+	ID uint `json:"id"`
+	chat_service.MessageUpdate
+}
+
+type MessagePage struct {
+	Messages   []ArchivedMessage `json:"messages"`
+	NextCursor *uint             `json:"nextCursor,omitempty"`
+}
+
+func parseTimeFilter(timeStr *string) (*time.Time, error) {
+	if timeStr == nil {
+		return nil, nil
+	}
+	parsedTime, err := time.Parse(time.RFC3339, *timeStr)
+	if err != nil {
+		return nil, fmt.Errorf("time \"%s\" is not in RFC3339 format", *timeStr)
+	}
+	return &parsedTime, nil
+}
+
+func (dbApiServer *DBApiServer) NewSessionMessageApi(r *mux.Router) {
+
+	r.Use(inputParsingMiddleware(func() any {
+		return &MessageFilter{}
+	}))
+	r.Use(authSessionOwnerMiddleware(dbApiServer.db))
+
+	r.PathPrefix("/").
+		Methods(http.MethodOptions).
+		HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			writer.Header().Set("Allow", strings.Join([]string{http.MethodOptions, http.MethodGet}, ", "))
+			writer.WriteHeader(http.StatusNoContent)
+		})
+
+	r.PathPrefix("/").
+		Methods(http.MethodGet).
+		HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			messageFilter, ok := req.Context().Value(CONTEXT_KEY_REQ_FILTER).(*MessageFilter)
+			if !ok {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusBadRequest)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "message filter is required")))
+				return
+			}
+
+			session, ok := req.Context().Value(CONTEXT_KEY_SESSION).(*models.GORMSession)
+			if !ok {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusBadRequest)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "session id is required")))
+				return
+			}
+
+			from, err := parseTimeFilter(messageFilter.From)
+			if err != nil {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusBadRequest)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, err.Error())))
+				return
+			}
+			to, err := parseTimeFilter(messageFilter.To)
+			if err != nil {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusBadRequest)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, err.Error())))
+				return
+			}
+
+			limit := DEFAULT_MESSAGES_LIMIT
+			if messageFilter.Limit != nil {
+				if *messageFilter.Limit <= 0 || *messageFilter.Limit > MAX_MESSAGES_LIMIT {
+					writer.Header().Set("Content-Type", "application/json")
+					writer.WriteHeader(http.StatusBadRequest)
+					_, _ = writer.Write([]byte(marshalReturnData(nil, fmt.Sprintf("limit must be between 1 and %d", MAX_MESSAGES_LIMIT))))
+					return
+				}
+				limit = *messageFilter.Limit
+			}
+
+			query := dbApiServer.db.
+				Where("session_uuid = ?", session.UUID)
+			if from != nil {
+				query = query.Where("update_time >= ?", *from)
+			}
+			if to != nil {
+				query = query.Where("update_time < ?", *to)
+			}
+			if messageFilter.Cursor != nil {
+				query = query.Where("id > ?", *messageFilter.Cursor)
+			}
+
+			var gormMessages []models.GORMMessage
+
+			result := query.
+				Order("id").
+				Limit(limit).
+				Find(&gormMessages)
+
+			if result.Error != nil {
+				fmt.Println(result.Error.Error())
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusInternalServerError)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "Internal Server Error")))
+				return
+			}
+
+			messagePage := MessagePage{
+				Messages: make([]ArchivedMessage, 0, len(gormMessages)),
+			}
+			for _, gormMessage := range gormMessages {
+				msgUpdate, err := gormMessage.MessageUpdate()
+				if err != nil {
+					fmt.Printf("Cannot read archived message %d: %s\n", gormMessage.ID, err.Error())
+					continue
+				}
+				messagePage.Messages = append(messagePage.Messages, ArchivedMessage{
+					ID:            gormMessage.ID,
+					MessageUpdate: msgUpdate,
+				})
+			}
+			if len(gormMessages) == limit {
+				nextCursor := gormMessages[len(gormMessages)-1].ID
+				messagePage.NextCursor = &nextCursor
+			}
+
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(http.StatusOK)
+			_, _ = writer.Write([]byte(marshalReturnData(messagePage, "")))
+
+		})
+
+	fmt.Println("Finished setting up /session/messages")
+}
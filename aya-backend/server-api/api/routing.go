@@ -165,6 +165,16 @@ func NewApiServer(db *gorm.DB, r *mux.Router) *DBApiServer {
 	})
 	r.Use(jwtAuthMiddleware)
 
+	// registered before /session so that the session handlers do not shadow them
+	sessionMessages := r.PathPrefix("/session/messages").Subrouter()
+	dbApiServer.NewSessionMessageApi(sessionMessages)
+
+	sessionSend := r.PathPrefix("/session/send").Subrouter()
+	dbApiServer.NewSessionSendApi(sessionSend)
+
+	sessionTokens := r.PathPrefix("/session/tokens").Subrouter()
+	dbApiServer.NewStreamTokenApi(sessionTokens)
+
 	session := r.PathPrefix("/session").Subrouter()
 	dbApiServer.NewSessionApi(session)
 
@@ -0,0 +1,135 @@
+package api
+
+import (
+	models "aya-backend/db-models"
+	"aya-backend/server-ws/chat_service"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// WS_INTERNAL_URL_ENV is the base url of the internal endpoints of server-ws, e.g. http://server_ws:8001
+	WS_INTERNAL_URL_ENV = "WS_INTERNAL_URL"
+
+	SEND_REQUEST_TIMEOUT = 15 * time.Second
+)
+
+type SendMessageFilter struct {
+	SessionFilter
+	Text string `json:"text"`
+	// Sources restricts the resources the text is sent to, every resource of the session if empty
+	Sources []chat_service.Source `json:"sources,omitempty"`
+	// ResourceKey restricts the text to the resource with the key, e.g. <guild id>/<channel id> for discord
+	ResourceKey string `json:"resourceKey,omitempty"`
+}
+
+type sendRequest struct {
+	SessionId   string                `json:"sessionId"`
+	Text        string                `json:"text"`
+	Sources     []chat_service.Source `json:"sources,omitempty"`
+	ResourceKey string                `json:"resourceKey,omitempty"`
+}
+
+type sendResponse struct {
+	Results []any  `json:"results"`
+	Err     string `json:"err,omitempty"`
+}
+
+// forwardSend asks server-ws to post the text, since it holds the connections to the platforms
+func forwardSend(request sendRequest) (int, sendResponse, error) {
+	wsUrl := os.Getenv(WS_INTERNAL_URL_ENV)
+	if wsUrl == "" {
+		return 0, sendResponse{}, fmt.Errorf("%s environment variable not set", WS_INTERNAL_URL_ENV)
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return 0, sendResponse{}, err
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/internal/send", strings.TrimSuffix(wsUrl, "/")), bytes.NewReader(body))
+	if err != nil {
+		return 0, sendResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", os.Getenv(models.INTERNAL_API_SECRET_ENV)))
+
+	client := http.Client{Timeout: SEND_REQUEST_TIMEOUT}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, sendResponse{}, err
+	}
+	defer res.Body.Close()
+
+	var response sendResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return 0, sendResponse{}, fmt.Errorf("cannot parse the response of server-ws (%d): %s", res.StatusCode, err.Error())
+	}
+	return res.StatusCode, response, nil
+}
+
+func (dbApiServer *DBApiServer) NewSessionSendApi(r *mux.Router) {
+
+	r.Use(inputParsingMiddleware(func() any {
+		return &SendMessageFilter{}
+	}))
+	r.Use(authSessionOwnerMiddleware(dbApiServer.db))
+
+	r.PathPrefix("/").
+		Methods(http.MethodOptions).
+		HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			writer.Header().Set("Allow", strings.Join([]string{http.MethodOptions, http.MethodPost}, ", "))
+			writer.WriteHeader(http.StatusNoContent)
+		})
+
+	r.PathPrefix("/").
+		Methods(http.MethodPost).
+		HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			sendFilter, ok := req.Context().Value(CONTEXT_KEY_REQ_FILTER).(*SendMessageFilter)
+			if !ok {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusBadRequest)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "send filter is required")))
+				return
+			}
+
+			session, ok := req.Context().Value(CONTEXT_KEY_SESSION).(*models.GORMSession)
+			if !ok {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusBadRequest)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "session id is required")))
+				return
+			}
+
+			if strings.TrimSpace(sendFilter.Text) == "" {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusBadRequest)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "text is required")))
+				return
+			}
+
+			status, response, err := forwardSend(sendRequest{
+				SessionId:   session.UUID.String(),
+				Text:        sendFilter.Text,
+				Sources:     sendFilter.Sources,
+				ResourceKey: sendFilter.ResourceKey,
+			})
+			if err != nil {
+				fmt.Printf("Cannot send the message of session %d: %s\n", session.ID, err.Error())
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusBadGateway)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "Cannot reach the chat server")))
+				return
+			}
+
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(status)
+			_, _ = writer.Write([]byte(marshalReturnData(response.Results, response.Err)))
+		})
+
+	fmt.Println("Finished setting up /session/send")
+}
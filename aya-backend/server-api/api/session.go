@@ -20,10 +20,22 @@ const (
 )
 
 type SessionFilter struct {
-	ID        *uint   `json:"id,omitempty" schema:"id"`
-	UserID    *uint   `json:"user_id,omitempty" schema:"user_id"`
-	IsOn      *bool   `json:"is_on,omitempty" schema:"is_on"`
-	Resources *string `json:"resources,omitempty" schema:"resources"`
+	ID              *uint   `json:"id,omitempty" schema:"id"`
+	UserID          *uint   `json:"user_id,omitempty" schema:"user_id"`
+	IsOn            *bool   `json:"is_on,omitempty" schema:"is_on"`
+	Resources       *string `json:"resources,omitempty" schema:"resources"`
+	ModerationRules *string `json:"moderation_rules,omitempty" schema:"moderation_rules"`
+	AllowedOrigins  *string `json:"allowed_origins,omitempty" schema:"allowed_origins"`
+}
+
+// sessionFilterProvider is implemented by the request filters that target a session,
+// so that they can be checked by authSessionOwnerMiddleware
+type sessionFilterProvider interface {
+	GetSessionFilter() *SessionFilter
+}
+
+func (sessionFilter *SessionFilter) GetSessionFilter() *SessionFilter {
+	return sessionFilter
 }
 
 func extractSessionFilter(sessionFilter *SessionFilter) (*models.GORMSession, []string) {
@@ -50,6 +62,16 @@ func extractSessionFilter(sessionFilter *SessionFilter) (*models.GORMSession, []
 		args = append(args, "resources")
 	}
 
+	if sessionFilter.ModerationRules != nil {
+		sessionQuery.ModerationRules = *sessionFilter.ModerationRules
+		args = append(args, "moderation_rules")
+	}
+
+	if sessionFilter.AllowedOrigins != nil {
+		sessionQuery.AllowedOrigins = *sessionFilter.AllowedOrigins
+		args = append(args, "allowed_origins")
+	}
+
 	return &sessionQuery, args
 
 }
@@ -65,13 +87,14 @@ func authSessionOwnerMiddleware(db *gorm.DB) mux.MiddlewareFunc {
 
 			newReqWithContext := req
 
-			sessionFilter, ok := req.Context().Value(CONTEXT_KEY_REQ_FILTER).(*SessionFilter)
+			sessionFilterProvider, ok := req.Context().Value(CONTEXT_KEY_REQ_FILTER).(sessionFilterProvider)
 			if !ok {
 				writer.Header().Set("Content-Type", "application/json")
 				writer.WriteHeader(http.StatusBadRequest)
 				_, _ = writer.Write([]byte(marshalReturnData(nil, "session filter is required")))
 				return
 			}
+			sessionFilter := sessionFilterProvider.GetSessionFilter()
 
 			jwtClaim, ok := req.Context().Value(CONTEXT_KEY_JWT_CLAIM).(jwt.MapClaims)
 			if !ok {
@@ -168,9 +191,30 @@ func validateResource(resources []models.Resource) error {
 	if len(resources) > MAX_RESOURCES {
 		return fmt.Errorf("too many resources attached to session")
 	}
+	for _, resource := range resources {
+		if err := resource.Validate(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func validateModerationRules(moderationRules *string) error {
+	if moderationRules == nil {
+		return nil
+	}
+	_, err := models.ParseModerationRules(*moderationRules)
+	return err
+}
+
+func validateAllowedOrigins(allowedOrigins *string) error {
+	if allowedOrigins == nil {
+		return nil
+	}
+	_, err := models.ParseAllowedOrigins(*allowedOrigins)
+	return err
+}
+
 func (dbApiServer *DBApiServer) NewSessionApi(r *mux.Router) {
 
 	r.Use(inputParsingMiddleware(func() any {
@@ -255,12 +299,34 @@ func (dbApiServer *DBApiServer) NewSessionApi(r *mux.Router) {
 				return
 			}
 
+			err = validateModerationRules(sessionFilter.ModerationRules)
+			if err != nil {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusBadRequest)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, fmt.Sprintf("Moderation rules not supported: %s", err.Error()))))
+				return
+			}
+
+			err = validateAllowedOrigins(sessionFilter.AllowedOrigins)
+			if err != nil {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusBadRequest)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, fmt.Sprintf("Allowed origins not supported: %s", err.Error()))))
+				return
+			}
+
 			newSession := models.GORMSession{
 				UserID:    *sessionFilter.UserID,
 				IsOn:      false,
 				Resources: *sessionFilter.Resources,
 				User:      *user,
 			}
+			if sessionFilter.ModerationRules != nil {
+				newSession.ModerationRules = *sessionFilter.ModerationRules
+			}
+			if sessionFilter.AllowedOrigins != nil {
+				newSession.AllowedOrigins = *sessionFilter.AllowedOrigins
+			}
 
 			result := dbApiServer.db.Create(&newSession)
 			if result.Error != nil {
@@ -298,30 +364,57 @@ func (dbApiServer *DBApiServer) NewSessionApi(r *mux.Router) {
 			}
 
 			// validate the input resources
-			var resourceInfos []models.Resource
-			err := json.Unmarshal([]byte(*sessionFilter.Resources), &resourceInfos)
+			if sessionFilter.Resources != nil {
+				var resourceInfos []models.Resource
+				err := json.Unmarshal([]byte(*sessionFilter.Resources), &resourceInfos)
+				if err != nil {
+					writer.Header().Set("Content-Type", "application/json")
+					writer.WriteHeader(http.StatusBadRequest)
+					_, _ = writer.Write([]byte(marshalReturnData(nil, fmt.Sprintf("Resource format not supported: %s", err.Error()))))
+					return
+				}
+
+				err = validateResource(resourceInfos)
+				if err != nil {
+					writer.Header().Set("Content-Type", "application/json")
+					writer.WriteHeader(http.StatusBadRequest)
+					_, _ = writer.Write([]byte(marshalReturnData(nil, fmt.Sprintf("Resource format not supported: %s", err.Error()))))
+					return
+				}
+			}
+
+			err := validateModerationRules(sessionFilter.ModerationRules)
 			if err != nil {
 				writer.Header().Set("Content-Type", "application/json")
 				writer.WriteHeader(http.StatusBadRequest)
-				_, _ = writer.Write([]byte(marshalReturnData(nil, fmt.Sprintf("Resource format not supported: %s", err.Error()))))
+				_, _ = writer.Write([]byte(marshalReturnData(nil, fmt.Sprintf("Moderation rules not supported: %s", err.Error()))))
 				return
 			}
 
-			err = validateResource(resourceInfos)
+			err = validateAllowedOrigins(sessionFilter.AllowedOrigins)
 			if err != nil {
 				writer.Header().Set("Content-Type", "application/json")
 				writer.WriteHeader(http.StatusBadRequest)
-				_, _ = writer.Write([]byte(marshalReturnData(nil, fmt.Sprintf("Resource format not supported: %s", err.Error()))))
+				_, _ = writer.Write([]byte(marshalReturnData(nil, fmt.Sprintf("Allowed origins not supported: %s", err.Error()))))
 				return
 			}
 
 			updateFilter := &SessionFilter{
-				IsOn:      sessionFilter.IsOn,
-				Resources: sessionFilter.Resources,
+				IsOn:            sessionFilter.IsOn,
+				Resources:       sessionFilter.Resources,
+				ModerationRules: sessionFilter.ModerationRules,
+				AllowedOrigins:  sessionFilter.AllowedOrigins,
 			}
 
 			updateSession, args := extractSessionFilter(updateFilter)
 
+			if len(args) == 0 {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusBadRequest)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "Nothing to update")))
+				return
+			}
+
 			sessionResult := dbApiServer.db.
 				Model(&session).
 				Select(args).
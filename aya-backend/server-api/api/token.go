@@ -0,0 +1,234 @@
+package api
+
+import (
+	models "aya-backend/db-models"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_STREAM_TOKEN_TTL = 30 * 24 * time.Hour
+	MAX_STREAM_TOKEN_TTL     = 365 * 24 * time.Hour
+)
+
+type StreamTokenFilter struct {
+	SessionFilter
+	TokenID *string `json:"token_id,omitempty" schema:"token_id"`
+	Label   *string `json:"label,omitempty" schema:"label"`
+	// TTL is the lifetime of the new token, in seconds
+	TTL *int64 `json:"ttl,omitempty" schema:"ttl"`
+}
+
+type StreamTokenInfo struct {
+	ID        uuid.UUID `json:"id"`
+	Label     string    `json:"label"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Token is only sent back when the token is created
+	Token string `json:"token,omitempty"`
+}
+
+func newStreamTokenInfo(token models.GORMStreamToken) StreamTokenInfo {
+	return StreamTokenInfo{
+		ID:        token.UUID,
+		Label:     token.Label,
+		CreatedAt: token.CreatedAt,
+		ExpiresAt: token.ExpiresAt,
+	}
+}
+
+func (dbApiServer *DBApiServer) NewStreamTokenApi(r *mux.Router) {
+
+	r.Use(inputParsingMiddleware(func() any {
+		return &StreamTokenFilter{}
+	}))
+	r.Use(authSessionOwnerMiddleware(dbApiServer.db))
+
+	r.PathPrefix("/").
+		Methods(http.MethodOptions).
+		HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			writer.Header().Set("Allow", strings.Join([]string{http.MethodOptions, http.MethodGet, http.MethodPost, http.MethodDelete}, ", "))
+			writer.WriteHeader(http.StatusNoContent)
+		})
+
+	r.PathPrefix("/").
+		Methods(http.MethodGet).
+		HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			session, ok := req.Context().Value(CONTEXT_KEY_SESSION).(*models.GORMSession)
+			if !ok {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusBadRequest)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "session id is required")))
+				return
+			}
+
+			var gormTokens []models.GORMStreamToken
+			result := dbApiServer.db.
+				Where("session_uuid = ? AND revoked_at IS NULL AND expires_at > ?", session.UUID, time.Now()).
+				Order("id").
+				Find(&gormTokens)
+
+			if result.Error != nil {
+				fmt.Println(result.Error.Error())
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusInternalServerError)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "Internal Server Error")))
+				return
+			}
+
+			tokens := make([]StreamTokenInfo, 0, len(gormTokens))
+			for _, gormToken := range gormTokens {
+				tokens = append(tokens, newStreamTokenInfo(gormToken))
+			}
+
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(http.StatusOK)
+			_, _ = writer.Write([]byte(marshalReturnData(tokens, "")))
+		})
+
+	r.PathPrefix("/").
+		Methods(http.MethodPost).
+		HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			tokenFilter, ok := req.Context().Value(CONTEXT_KEY_REQ_FILTER).(*StreamTokenFilter)
+			if !ok {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusBadRequest)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "token filter is required")))
+				return
+			}
+
+			session, ok := req.Context().Value(CONTEXT_KEY_SESSION).(*models.GORMSession)
+			if !ok {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusBadRequest)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "session id is required")))
+				return
+			}
+
+			secret := os.Getenv(models.STREAM_TOKEN_SECRET_ENV)
+			if secret == "" {
+				fmt.Printf("%s environment variable not set, cannot issue stream tokens\n", models.STREAM_TOKEN_SECRET_ENV)
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusInternalServerError)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "Internal Server Error")))
+				return
+			}
+
+			ttl := DEFAULT_STREAM_TOKEN_TTL
+			if tokenFilter.TTL != nil {
+				ttl = time.Duration(*tokenFilter.TTL) * time.Second
+				if ttl <= 0 || ttl > MAX_STREAM_TOKEN_TTL {
+					writer.Header().Set("Content-Type", "application/json")
+					writer.WriteHeader(http.StatusBadRequest)
+					_, _ = writer.Write([]byte(marshalReturnData(nil, fmt.Sprintf("ttl must be between 1 and %d seconds", int64(MAX_STREAM_TOKEN_TTL.Seconds())))))
+					return
+				}
+			}
+
+			gormToken := models.GORMStreamToken{
+				SessionUUID: session.UUID,
+				ExpiresAt:   time.Now().Add(ttl),
+			}
+			if tokenFilter.Label != nil {
+				gormToken.Label = *tokenFilter.Label
+			}
+
+			if result := dbApiServer.db.Create(&gormToken); result.Error != nil {
+				fmt.Println(result.Error.Error())
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusInternalServerError)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "Internal Server Error")))
+				return
+			}
+
+			tokenStr, err := gormToken.Sign([]byte(secret))
+			if err != nil {
+				fmt.Println(err.Error())
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusInternalServerError)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "Internal Server Error")))
+				return
+			}
+
+			tokenInfo := newStreamTokenInfo(gormToken)
+			tokenInfo.Token = tokenStr
+
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(http.StatusCreated)
+			_, _ = writer.Write([]byte(marshalReturnData(tokenInfo, "")))
+		})
+
+	r.PathPrefix("/").
+		Methods(http.MethodDelete).
+		HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			tokenFilter, ok := req.Context().Value(CONTEXT_KEY_REQ_FILTER).(*StreamTokenFilter)
+			if !ok || tokenFilter.TokenID == nil {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusBadRequest)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "token id is required")))
+				return
+			}
+
+			session, ok := req.Context().Value(CONTEXT_KEY_SESSION).(*models.GORMSession)
+			if !ok {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusBadRequest)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "session id is required")))
+				return
+			}
+
+			tokenUUID, err := uuid.Parse(*tokenFilter.TokenID)
+			if err != nil {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusBadRequest)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "token id is not a valid uuid")))
+				return
+			}
+
+			var gormToken models.GORMStreamToken
+			result := dbApiServer.db.
+				Where("uuid = ? AND session_uuid = ?", tokenUUID, session.UUID).
+				First(&gormToken)
+
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusNotFound)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "token does not exists")))
+				return
+			}
+			if result.Error != nil {
+				fmt.Println(result.Error.Error())
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusInternalServerError)
+				_, _ = writer.Write([]byte(marshalReturnData(nil, "Internal Server Error")))
+				return
+			}
+
+			if gormToken.RevokedAt == nil {
+				revokedAt := time.Now()
+				result = dbApiServer.db.
+					Model(&gormToken).
+					Update("revoked_at", revokedAt)
+				if result.Error != nil {
+					fmt.Println(result.Error.Error())
+					writer.Header().Set("Content-Type", "application/json")
+					writer.WriteHeader(http.StatusInternalServerError)
+					_, _ = writer.Write([]byte(marshalReturnData(nil, "Internal Server Error")))
+					return
+				}
+			}
+
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(http.StatusOK)
+			_, _ = writer.Write([]byte(marshalReturnData(newStreamTokenInfo(gormToken), "")))
+		})
+
+	fmt.Println("Finished setting up /session/tokens")
+}
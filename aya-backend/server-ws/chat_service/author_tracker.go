@@ -0,0 +1,141 @@
+package chat_service
+
+import (
+	"container/list"
+	"slices"
+	"sync"
+)
+
+const (
+	// TRACKED_MESSAGES_PER_AUTHOR is the number of recent messages of a user that are
+	// deleted when the user is banned or timed out
+	TRACKED_MESSAGES_PER_AUTHOR = 50
+	// TRACKED_AUTHORS_PER_RESOURCE is the number of recently active authors of a resource
+	// whose messages are tracked, the others are forgotten
+	TRACKED_AUTHORS_PER_RESOURCE = 1000
+)
+
+// AuthorMessageTracker remembers the ids of the recent messages of each author in a
+// resource, so that they can be deleted when the author is banned or timed out.
+// Only the most recently active authors of each resource are remembered.
+type AuthorMessageTracker struct {
+	mutex       sync.Mutex
+	maxAuthors  int
+	maxMessages int
+	// resource key -> tracked authors of the resource
+	resources map[string]*trackedResource
+}
+
+type trackedResource struct {
+	// authors of the resource, least recently active first
+	order *list.List
+	// author id -> element of the author in the order
+	authors map[string]*list.Element
+	// message id -> author id, to forget the messages deleted one by one
+	messageAuthors map[string]string
+}
+
+type trackedAuthor struct {
+	id string
+	// message ids, oldest first
+	messageIds []string
+}
+
+func NewAuthorMessageTracker(maxAuthors int, maxMessages int) *AuthorMessageTracker {
+	return &AuthorMessageTracker{
+		maxAuthors:  maxAuthors,
+		maxMessages: maxMessages,
+		resources:   make(map[string]*trackedResource),
+	}
+}
+
+// removeAuthor forgets the author and its messages, and returns their ids
+func (resource *trackedResource) removeAuthor(element *list.Element) []string {
+	author := resource.order.Remove(element).(*trackedAuthor)
+	delete(resource.authors, author.id)
+	for _, messageId := range author.messageIds {
+		delete(resource.messageAuthors, messageId)
+	}
+	return author.messageIds
+}
+
+func (tracker *AuthorMessageTracker) Track(resourceKey string, authorId string, messageId string) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	resource, ok := tracker.resources[resourceKey]
+	if !ok {
+		resource = &trackedResource{
+			order:          list.New(),
+			authors:        make(map[string]*list.Element),
+			messageAuthors: make(map[string]string),
+		}
+		tracker.resources[resourceKey] = resource
+	}
+
+	element, ok := resource.authors[authorId]
+	if ok {
+		resource.order.MoveToBack(element)
+	} else {
+		element = resource.order.PushBack(&trackedAuthor{id: authorId})
+		resource.authors[authorId] = element
+	}
+	author := element.Value.(*trackedAuthor)
+	author.messageIds = append(author.messageIds, messageId)
+	resource.messageAuthors[messageId] = authorId
+	if len(author.messageIds) > tracker.maxMessages {
+		for _, forgottenId := range author.messageIds[:len(author.messageIds)-tracker.maxMessages] {
+			delete(resource.messageAuthors, forgottenId)
+		}
+		author.messageIds = author.messageIds[len(author.messageIds)-tracker.maxMessages:]
+	}
+
+	if resource.order.Len() > tracker.maxAuthors {
+		resource.removeAuthor(resource.order.Front())
+	}
+}
+
+// RemoveAuthor forgets the messages of the author in the resource, and returns their ids
+func (tracker *AuthorMessageTracker) RemoveAuthor(resourceKey string, authorId string) []string {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	resource, ok := tracker.resources[resourceKey]
+	if !ok {
+		return []string{}
+	}
+	element, ok := resource.authors[authorId]
+	if !ok {
+		return []string{}
+	}
+	return resource.removeAuthor(element)
+}
+
+// RemoveMessage forgets a message deleted on its own, so that it is not deleted again
+// when its author is banned
+func (tracker *AuthorMessageTracker) RemoveMessage(resourceKey string, messageId string) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	resource, ok := tracker.resources[resourceKey]
+	if !ok {
+		return
+	}
+	authorId, ok := resource.messageAuthors[messageId]
+	if !ok {
+		return
+	}
+	delete(resource.messageAuthors, messageId)
+	element := resource.authors[authorId]
+	author := element.Value.(*trackedAuthor)
+	author.messageIds = slices.DeleteFunc(author.messageIds, func(id string) bool {
+		return id == messageId
+	})
+	if len(author.messageIds) == 0 {
+		resource.removeAuthor(element)
+	}
+}
+
+// RemoveResource forgets the messages of every author in the resource
+func (tracker *AuthorMessageTracker) RemoveResource(resourceKey string) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	delete(tracker.resources, resourceKey)
+}
@@ -0,0 +1,57 @@
+package chat_service
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAuthorMessageTracker(t *testing.T) {
+	tracker := NewAuthorMessageTracker(2, 3)
+	for _, messageId := range []string{"a1", "a2", "a3", "a4"} {
+		tracker.Track("r", "alice", messageId)
+	}
+	tracker.Track("r", "bob", "b1")
+	tracker.Track("other", "alice", "o1")
+
+	// only the most recent messages of an author are kept
+	if got := tracker.RemoveAuthor("r", "alice"); !slices.Equal(got, []string{"a2", "a3", "a4"}) {
+		t.Errorf("alice messages = %v, want [a2 a3 a4]", got)
+	}
+	if got := tracker.RemoveAuthor("r", "alice"); len(got) != 0 {
+		t.Errorf("alice messages after the removal = %v", got)
+	}
+
+	// the least recently active author is forgotten
+	tracker.Track("r", "carol", "c1")
+	tracker.Track("r", "bob", "b2")
+	tracker.Track("r", "dave", "d1")
+	if got := tracker.RemoveAuthor("r", "carol"); len(got) != 0 {
+		t.Errorf("carol messages = %v, want them forgotten", got)
+	}
+	if got := tracker.RemoveAuthor("r", "bob"); !slices.Equal(got, []string{"b1", "b2"}) {
+		t.Errorf("bob messages = %v, want [b1 b2]", got)
+	}
+
+	// a deleted message is not deleted again on a ban
+	tracker.Track("r", "dave", "d2")
+	tracker.RemoveMessage("r", "d1")
+	tracker.RemoveMessage("r", "unknown")
+	if got := tracker.RemoveAuthor("r", "dave"); !slices.Equal(got, []string{"d2"}) {
+		t.Errorf("dave messages = %v, want [d2]", got)
+	}
+
+	// the resources are tracked apart
+	tracker.RemoveResource("r")
+	if got := tracker.RemoveAuthor("other", "alice"); !slices.Equal(got, []string{"o1"}) {
+		t.Errorf("alice messages in the other resource = %v, want [o1]", got)
+	}
+}
+
+func TestAuthorMessageTrackerRemovesEmptyAuthors(t *testing.T) {
+	tracker := NewAuthorMessageTracker(10, 10)
+	tracker.Track("r", "alice", "a1")
+	tracker.RemoveMessage("r", "a1")
+	if resource := tracker.resources["r"]; resource.order.Len() != 0 || len(resource.authors) != 0 || len(resource.messageAuthors) != 0 {
+		t.Errorf("author without messages is still tracked")
+	}
+}
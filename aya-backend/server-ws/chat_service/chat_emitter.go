@@ -8,3 +8,9 @@ type ChatEmitter interface {
 	// ErrorEmitter emits error if exists
 	ErrorEmitter() chan error
 }
+
+// ChatSender is implemented by the emitters that can post messages to their platform
+type ChatSender interface {
+	// SendMessage posts the text to the chat of the resource
+	SendMessage(resourceInfo any, text string) error
+}
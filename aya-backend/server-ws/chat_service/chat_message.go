@@ -6,41 +6,19 @@ import (
 	"time"
 )
 
-type Source int
-
-const (
-	Discord Source = iota
-	Twitch
-	Youtube
-	TestSource
-)
-
-var (
-	sourceToStr = map[int]string{
-		0: "discord",
-		1: "twitch",
-		2: "youtube",
-		3: "test_source",
-	}
-
-	strToSource = map[string]int{
-		"discord":     0,
-		"twitch":      1,
-		"youtube":     2,
-		"test_source": 3,
-	}
-)
+// Source is the name of a chat source, e.g. "discord". Sources are provided by
+// the plugins registered with RegisterSource.
+type Source string
 
 func ParseSource(s string) (Source, error) {
-	value, ok := strToSource[s]
-	if !ok {
-		return Source(-1), fmt.Errorf(`cannot detect "%s", not a valid source`, s)
+	if _, ok := GetSourcePlugin(Source(s)); !ok {
+		return Source(""), fmt.Errorf(`cannot detect "%s", not a valid source`, s)
 	}
-	return Source(value), nil
+	return Source(s), nil
 }
 
 func (s Source) String() string {
-	return sourceToStr[int(s)]
+	return string(s)
 }
 
 func (s Source) MarshalJSON() ([]byte, error) {
@@ -65,6 +43,10 @@ const (
 	New Update = iota
 	Delete
 	Edit
+	// Clear removes every message of the resource the update comes from
+	Clear
+	// Reaction is sent when a reaction is added to or removed from a message
+	Reaction
 )
 
 var (
@@ -72,12 +54,16 @@ var (
 		0: "new",
 		1: "delete",
 		2: "edit",
+		3: "clear",
+		4: "reaction",
 	}
 
 	strToUpdate = map[string]int{
-		"new":    0,
-		"delete": 1,
-		"edit":   2,
+		"new":      0,
+		"delete":   1,
+		"edit":     2,
+		"clear":    3,
+		"reaction": 4,
 	}
 )
 
@@ -97,7 +83,21 @@ func (s Update) MarshalJSON() ([]byte, error) {
 	return json.Marshal(s.String())
 }
 
-type Attachment string
+// MarshalText sends the update as its name in the CBOR frames too
+func (s Update) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+type Attachment struct {
+	Url         string `json:"url"`
+	ProxyUrl    string `json:"proxyUrl,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	Size        int    `json:"size,omitempty"`
+	Spoiler     bool   `json:"spoiler,omitempty"`
+}
 
 func (s *Update) UnmarshalJSON(data []byte) error {
 	var update string
@@ -117,6 +117,71 @@ type Message struct {
 	Author       Author        `json:"author"`
 	MessageParts []MessagePart `json:"messageParts"`
 	Attachments  []Attachment  `json:"attachments"`
+	Event        *MessageEvent `json:"event,omitempty"`
+	ReplyTo      *ReplyTo      `json:"replyTo,omitempty"`
+	Thread       *Thread       `json:"thread,omitempty"`
+	// Reactions are the reaction counts of the message, set on reaction updates. They are
+	// always sent, so that an empty list tells that every reaction has been removed.
+	Reactions []MessageReaction `json:"reactions"`
+}
+
+// MessageReaction is the number of users that reacted to a message with an emoji
+type MessageReaction struct {
+	Emoji Emoji `json:"emoji"`
+	Count int   `json:"count"`
+}
+
+// ReactionChange describes the reaction that triggered a reaction update. It is
+// not set when every reaction of the message has been removed at once.
+type ReactionChange struct {
+	Emoji Emoji  `json:"emoji"`
+	User  Author `json:"user"`
+	// Added is false when the user removed the reaction
+	Added bool `json:"added"`
+}
+
+// ReplyTo describes the message that a message is replying to
+type ReplyTo struct {
+	Id string `json:"id"`
+	// Author of the original message, if the original message is still available
+	Author *Author `json:"author,omitempty"`
+	// Preview is the truncated text of the original message
+	Preview string `json:"preview,omitempty"`
+}
+
+// Thread describes the thread that a message is sent in
+type Thread struct {
+	Id       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	ParentId string `json:"parentId,omitempty"`
+}
+
+// MessageEvent is set on the messages that are sent by the platform for a chat
+// event, e.g. a subscription or a raid, instead of being typed by the author.
+type MessageEvent struct {
+	// Type of the event as named by the source, e.g. "sub", "resub", "raid" or "subgift"
+	Type string `json:"type"`
+	// SystemMessage is the text the platform shows for the event
+	SystemMessage string `json:"systemMessage,omitempty"`
+	// Tier of the subscription or membership
+	Tier string `json:"tier,omitempty"`
+	// Months of the subscription or membership
+	Months int `json:"months,omitempty"`
+	// Count is the number of viewers of a raid, or the number of gifted subscriptions
+	Count int `json:"count,omitempty"`
+	// Recipient is the name of the user receiving a gift
+	Recipient string `json:"recipient,omitempty"`
+	// Amount paid for the event as displayed by the platform, e.g. "$5.00"
+	Amount string `json:"amount,omitempty"`
+	// AmountMicros is the amount paid in micros of the currency
+	AmountMicros uint64 `json:"amountMicros,omitempty"`
+	// Currency is the ISO 4217 code of the currency of the amount
+	Currency string `json:"currency,omitempty"`
+	// HighlightColor is the color the platform highlights the message with
+	HighlightColor string `json:"highlightColor,omitempty"`
+	// StickerId and StickerAlt describe the sticker sent with the event
+	StickerId  string `json:"stickerId,omitempty"`
+	StickerAlt string `json:"stickerAlt,omitempty"`
 }
 
 type Emoji struct {
@@ -125,7 +190,15 @@ type Emoji struct {
 }
 
 type Format struct {
-	Color string `json:"color,omitempty"`
+	Color     string `json:"color,omitempty"`
+	Bold      bool   `json:"bold,omitempty"`
+	Italic    bool   `json:"italic,omitempty"`
+	Underline bool   `json:"underline,omitempty"`
+	Strike    bool   `json:"strike,omitempty"`
+	Code      bool   `json:"code,omitempty"`
+	Spoiler   bool   `json:"spoiler,omitempty"`
+	// Link is the url the part links to
+	Link string `json:"link,omitempty"`
 }
 
 type MessagePart struct {
@@ -134,16 +207,32 @@ type MessagePart struct {
 	Format  *Format `json:"format,omitempty"`
 }
 
+type Badge struct {
+	// Name of the badge, e.g. "subscriber", "vip" or "moderator"
+	Name     string `json:"name"`
+	Version  string `json:"version,omitempty"`
+	ImageUrl string `json:"imageUrl,omitempty"`
+}
+
 type Author struct {
-	Username string `json:"username"`
-	IsAdmin  bool   `json:"isAdmin"`
-	IsBot    bool   `json:"isBot"`
-	Color    string `json:"color"`
+	// Id is the id of the user on the platform, stable across name changes
+	Id string `json:"id,omitempty"`
+	// Username is the login name of the user, or the display name if the platform has none
+	Username    string  `json:"username"`
+	DisplayName string  `json:"displayName,omitempty"`
+	AvatarUrl   string  `json:"avatarUrl,omitempty"`
+	ProfileUrl  string  `json:"profileUrl,omitempty"`
+	IsAdmin     bool    `json:"isAdmin"`
+	IsBot       bool    `json:"isBot"`
+	Color       string  `json:"color"`
+	Badges      []Badge `json:"badges,omitempty"`
 }
 
 type MessageUpdate struct {
-	UpdateTime  time.Time `json:"updateTime"`
-	Update      Update    `json:"update"`
-	Message     Message   `json:"message"`
-	ExtraFields any       `json:"-"`
+	UpdateTime  time.Time       `json:"updateTime"`
+	Update      Update          `json:"update"`
+	Message     Message         `json:"message"`
+	Reaction    *ReactionChange `json:"reaction,omitempty"`
+	Seq         uint64          `json:"seq,omitempty"` // sequence number within the session, set when sent to it
+	ExtraFields any             `json:"-"`
 }
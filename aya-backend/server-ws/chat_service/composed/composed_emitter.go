@@ -2,56 +2,36 @@ package composed
 
 import (
 	"aya-backend/server-ws/chat_service"
-	discordsource "aya-backend/server-ws/chat_service/discord"
-	"aya-backend/server-ws/chat_service/test_source"
-	twitchsource "aya-backend/server-ws/chat_service/twitch"
-	youtubesource "aya-backend/server-ws/chat_service/youtube"
+	_ "aya-backend/server-ws/chat_service/sources"
 	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
-	"os"
-)
-
-const (
-	YOUTUBE_API_KEY_ENV       = "YOUTUBE_API_KEY"
-	YOUTUBE_CLIENT_ID_ENV     = "YOUTUBE_CLIENT_ID"
-	YOUTUBE_CLIENT_SECRET_ENV = "YOUTUBE_CLIENT_SECRET"
-	YOUTUBE_FLOW_ENV          = "YOUTUBE_FLOW"
-
-	DISCORD_TOKEN_ENV = "DISCORD_TOKEN"
-
-	TWITCH_CLIENT_ID_ENV     = "TWITCH_CLIENT_ID"
-	TWITCH_CLIENT_SECRET_ENV = "TWITCH_CLIENT_SECRET"
-	TWITCH_BOT_USERNAME_ENV  = "TWITCH_BOT_USERNAME"
 )
 
 type MessageEmitter struct {
 	chat_service.ChatEmitter
-	discordEmitter *discordsource.DiscordEmitter
-	testEmitter    *test_source.TestEmitter
-	youtubeEmitter *youtubesource.YoutubeEmitter
-	twitchEmitter  *twitchsource.TwitchEmitter
+	emitters map[chat_service.Source]chat_service.SourceEmitter
 
 	updateEmitter chan chat_service.MessageUpdate
 }
 
-func (messageEmitter *MessageEmitter) GetDiscordEmitter() *discordsource.DiscordEmitter {
-	return messageEmitter.discordEmitter
-}
-
-func (messageEmitter *MessageEmitter) GetYoutubeEmitter() *youtubesource.YoutubeEmitter {
-	return messageEmitter.youtubeEmitter
+// GetEmitter returns the emitter of the source, if the source is enabled
+func (messageEmitter *MessageEmitter) GetEmitter(source chat_service.Source) (chat_service.SourceEmitter, bool) {
+	emitter, ok := messageEmitter.emitters[source]
+	return emitter, ok
 }
 
-func (messageEmitter *MessageEmitter) GetTwitchEmitter() *twitchsource.TwitchEmitter {
-	return messageEmitter.twitchEmitter
+// Sources returns the sources that have a running emitter
+func (messageEmitter *MessageEmitter) Sources() []chat_service.Source {
+	sources := make([]chat_service.Source, 0, len(messageEmitter.emitters))
+	for source := range messageEmitter.emitters {
+		sources = append(sources, source)
+	}
+	return sources
 }
 
 type MessageChannelConfig struct {
-	Discord bool
-	Test    bool
-	Youtube bool
-	Twitch  bool
+	Sources []chat_service.Source
 	BaseURL string
 	Router  *mux.Router
 }
@@ -64,23 +44,14 @@ func (messageEmitter *MessageEmitter) CloseEmitter() error {
 
 	close(messageEmitter.updateEmitter)
 
-	var testError error = nil
-	var discordError error = nil
-	var youtubeError error = nil
-
-	if messageEmitter.testEmitter != nil {
-		testError = messageEmitter.testEmitter.CloseEmitter()
-	}
-
-	if messageEmitter.discordEmitter != nil {
-		discordError = messageEmitter.discordEmitter.CloseEmitter()
-	}
-
-	if messageEmitter.youtubeEmitter != nil {
-		testError = messageEmitter.youtubeEmitter.CloseEmitter()
+	var errList []error
+	for source, emitter := range messageEmitter.emitters {
+		if err := emitter.CloseEmitter(); err != nil {
+			errList = append(errList, fmt.Errorf("%s: %w", source, err))
+		}
 	}
 
-	err := errors.Join(testError, discordError, youtubeError)
+	err := errors.Join(errList...)
 
 	if err != nil {
 		return fmt.Errorf("error encounter during closing: %w", err)
@@ -92,117 +63,50 @@ func (messageEmitter *MessageEmitter) CloseEmitter() error {
 func NewMessageEmitter(messageChannelConfig *MessageChannelConfig) *MessageEmitter {
 
 	messageChannel := MessageEmitter{
-		testEmitter:    nil,
-		discordEmitter: nil,
-		youtubeEmitter: nil,
+		emitters: make(map[chat_service.Source]chat_service.SourceEmitter),
 	}
 
-	if messageChannelConfig.Test {
-		testEmitter := test_source.NewEmitter()
-		messageChannel.testEmitter = testEmitter
+	emitterConfig := chat_service.EmitterConfig{
+		AuthRouter:           messageChannelConfig.Router.PathPrefix("/auth").Subrouter(),
+		AuthRedirectBasedUrl: fmt.Sprintf("%s/auth", messageChannelConfig.BaseURL),
 	}
 
-	if messageChannelConfig.Discord {
-		discordToken := os.Getenv(DISCORD_TOKEN_ENV)
-		discordEmitter, err := discordsource.NewEmitter(discordToken)
-
-		if err != nil {
-			fmt.Printf("Error during creating a discord emitter: %s\n", err.Error())
+	for _, source := range messageChannelConfig.Sources {
+		plugin, ok := chat_service.GetSourcePlugin(source)
+		if !ok {
+			fmt.Printf("Source %s is not registered, skipping\n", source)
+			continue
 		}
-
-		messageChannel.discordEmitter = discordEmitter
-	}
-
-	if messageChannelConfig.Youtube {
-		ytApiKey := os.Getenv(YOUTUBE_API_KEY_ENV)
-		ytClientId := os.Getenv(YOUTUBE_CLIENT_ID_ENV)
-		ytClientSecret := os.Getenv(YOUTUBE_CLIENT_SECRET_ENV)
-
-		ytEmitterConfig := &youtubesource.YoutubeEmitterConfig{}
-
-		ytEmitterConfig.ApiKey = ytApiKey
-		ytEmitterConfig.ClientID = ytClientId
-		ytEmitterConfig.ClientSecret = ytClientSecret
-		ytEmitterConfig.AuthRouter = messageChannelConfig.Router.PathPrefix("/auth").Subrouter()
-		ytEmitterConfig.AuthRedirectBasedUrl = fmt.Sprintf("%s/auth", messageChannelConfig.BaseURL)
-
-		youtubeEmitter, err := youtubesource.NewEmitter(ytEmitterConfig)
+		emitter, err := plugin.NewEmitter(emitterConfig)
 		if err != nil {
-			fmt.Printf("Error during creating a youtube emitter: %s\n", err.Error())
-		} else {
-			messageChannel.youtubeEmitter = youtubeEmitter
-		}
-	}
-
-	if messageChannelConfig.Twitch {
-		twitchClientId := os.Getenv(TWITCH_CLIENT_ID_ENV)
-		twitchClientSecret := os.Getenv(TWITCH_CLIENT_SECRET_ENV)
-		twitchBotUsername := os.Getenv(TWITCH_BOT_USERNAME_ENV)
-
-		twitchEmitterConfig := twitchsource.TwitchEmitterConfig{}
-
-		twitchEmitterConfig.ClientID = twitchClientId
-		twitchEmitterConfig.ClientSecret = twitchClientSecret
-		twitchEmitterConfig.BotUserName = twitchBotUsername
-		twitchEmitterConfig.AuthRouter = messageChannelConfig.Router.PathPrefix("/auth").Subrouter()
-		twitchEmitterConfig.AuthRedirectBasedUrl = fmt.Sprintf("%s/auth", messageChannelConfig.BaseURL)
-
-		twitchEmitter, err := twitchsource.NewEmitter(twitchEmitterConfig)
-		if err != nil {
-			fmt.Printf("Error during creating a twitch emitter: %s\n", err.Error())
-		} else {
-			messageChannel.twitchEmitter = twitchEmitter
+			fmt.Printf("Error during creating a %s emitter: %s\n", source, err.Error())
+			continue
 		}
+		messageChannel.emitters[source] = emitter
 	}
 
 	msgC := make(chan chat_service.MessageUpdate)
 
-	if messageChannel.testEmitter != nil {
-		go func() {
-			for {
-				testMsg := <-messageChannel.testEmitter.UpdateEmitter()
-				fmt.Println("Message from test source!")
-				msgC <- testMsg
-			}
-		}()
-	}
-
-	if messageChannel.discordEmitter != nil {
+	for source, emitter := range messageChannel.emitters {
 		go func() {
-			for {
-				discordMsg := <-messageChannel.discordEmitter.UpdateEmitter()
-				fmt.Println("Message from discord!")
-				msgC <- discordMsg
-			}
-		}()
-	}
-
-	if messageChannel.youtubeEmitter != nil {
-		go func() {
-			for {
+			updates := emitter.UpdateEmitter()
+			errs := emitter.ErrorEmitter()
+			for updates != nil {
 				select {
-				case ytMsg := <-messageChannel.youtubeEmitter.UpdateEmitter():
-					fmt.Println("Message from youtube!")
-					msgC <- ytMsg
-				case err := <-messageChannel.youtubeEmitter.ErrorEmitter():
-					fmt.Printf("Error from youtube:%s\n", err.Error())
+				case msg, ok := <-updates:
+					if !ok {
+						updates = nil
+						continue
+					}
+					fmt.Printf("Message from %s!\n", source)
+					msgC <- msg
+				case err, ok := <-errs:
+					if !ok {
+						errs = nil
+						continue
+					}
+					fmt.Printf("Error from %s:%s\n", source, err.Error())
 				}
-
-			}
-		}()
-	}
-
-	if messageChannel.twitchEmitter != nil {
-		go func() {
-			for {
-				select {
-				case twitchMsg := <-messageChannel.twitchEmitter.UpdateEmitter():
-					fmt.Println("Message from twitch!")
-					msgC <- twitchMsg
-				case err := <-messageChannel.twitchEmitter.ErrorEmitter():
-					fmt.Printf("Error from twitch:%s\n", err.Error())
-				}
-
 			}
 		}()
 	}
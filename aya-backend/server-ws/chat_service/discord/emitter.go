@@ -2,6 +2,7 @@ package discord_source
 
 import (
 	"aya-backend/server-ws/chat_service"
+	"encoding/json"
 	"fmt"
 	dg "github.com/bwmarrin/discordgo"
 	"github.com/fatih/color"
@@ -10,10 +11,13 @@ import (
 
 type DiscordEmitter struct {
 	chat_service.ChatEmitter
+	chat_service.ResourceRegister
 	mutex         sync.Mutex
 	updateEmitter chan chat_service.MessageUpdate
+	errorEmitter  chan error
 	discordClient *dg.Session
 	register      *discordRegister
+	reactions     *reactionCounter
 
 	resource2Subscriber map[string]map[string]bool
 }
@@ -62,11 +66,38 @@ func (emitter *DiscordEmitter) UpdateEmitter() chan chat_service.MessageUpdate {
 	return emitter.updateEmitter
 }
 
+func (emitter *DiscordEmitter) ErrorEmitter() chan error {
+	return emitter.errorEmitter
+}
+
+func (emitter *DiscordEmitter) SendMessage(resourceInfo any, text string) error {
+	discordInfo, ok := resourceInfo.(DiscordInfo)
+	if !ok {
+		return fmt.Errorf("resource info is not a discord resource")
+	}
+	_, err := emitter.discordClient.ChannelMessageSend(discordInfo.DiscordChannelId, text)
+	return err
+}
+
 func (emitter *DiscordEmitter) CloseEmitter() error {
 	close(emitter.updateEmitter)
 	return emitter.discordClient.Close()
 }
 
+// matchChannel returns the subscribed channel an event of the channel is sent to, and the
+// thread of the event if it happened in a thread of the subscribed channel. The registered
+// channels are checked first, the thread is only looked up when the channel is not one of them.
+func (emitter *DiscordEmitter) matchChannel(parser *DiscordMessageParser, guildId string, channelId string) (string, *chat_service.Thread, bool) {
+	if emitter.register.check(guildId, channelId) {
+		return channelId, nil, true
+	}
+	thread := parser.ParseThread(channelId)
+	if thread == nil || !emitter.register.check(guildId, thread.ParentId) {
+		return "", nil, false
+	}
+	return thread.ParentId, thread, true
+}
+
 func NewEmitter(token string) (*DiscordEmitter, error) {
 	messageUpdates := make(chan chat_service.MessageUpdate)
 
@@ -78,74 +109,106 @@ func NewEmitter(token string) (*DiscordEmitter, error) {
 	discordEmitter := DiscordEmitter{
 		discordClient:       client,
 		updateEmitter:       messageUpdates,
+		errorEmitter:        make(chan error),
 		register:            newDiscordRegister(),
+		reactions:           newReactionCounter(client, REACTION_TRACKED_MESSAGES),
 		resource2Subscriber: make(map[string]map[string]bool),
 	}
 
 	discordMsgParser := NewParser(client)
 
 	client.Identify.Intents = dg.IntentsAll
+	client.State.MaxMessageCount = STATE_MESSAGES_PER_CHANNEL
 
 	client.AddHandler(func(s *dg.Session, m *dg.MessageCreate) {
-		if discordEmitter.register.check(m.GuildID, m.ChannelID) {
+		if channelId, thread, ok := discordEmitter.matchChannel(&discordMsgParser, m.GuildID, m.ChannelID); ok {
 
 			messageUpdates <- chat_service.MessageUpdate{
 				UpdateTime: m.Timestamp,
 				Update:     chat_service.New,
 				Message: chat_service.Message{
-					Source:       chat_service.Discord,
+					Source:       DiscordSource,
 					Id:           m.ID,
 					Author:       discordMsgParser.ParseAuthor(m.Author, m.ChannelID),
 					MessageParts: discordMsgParser.ParseMessage(m.Message),
 					Attachments:  discordMsgParser.ParseAttachment(m.Message),
+					ReplyTo:      discordMsgParser.ParseReplyTo(m.Message),
+					Thread:       thread,
 				},
 				ExtraFields: DiscordInfo{
 					DiscordGuildId:   m.GuildID,
-					DiscordChannelId: m.ChannelID,
+					DiscordChannelId: channelId,
 				},
 			}
 		}
 	})
 
 	client.AddHandler(func(s *dg.Session, m *dg.MessageDelete) {
-		if discordEmitter.register.check(m.GuildID, m.ChannelID) {
+		if channelId, _, ok := discordEmitter.matchChannel(&discordMsgParser, m.GuildID, m.ChannelID); ok {
 
 			messageUpdates <- chat_service.MessageUpdate{
 				UpdateTime: m.Timestamp,
 				Update:     chat_service.Delete,
 				Message: chat_service.Message{
-					Source: chat_service.Discord,
+					Source: DiscordSource,
 					Id:     m.ID,
 				},
 				ExtraFields: DiscordInfo{
 					DiscordGuildId:   m.GuildID,
-					DiscordChannelId: m.ChannelID,
+					DiscordChannelId: channelId,
 				},
 			}
 		}
 	})
 
 	client.AddHandler(func(s *dg.Session, m *dg.MessageUpdate) {
-		if discordEmitter.register.check(m.GuildID, m.ChannelID) {
+		if channelId, thread, ok := discordEmitter.matchChannel(&discordMsgParser, m.GuildID, m.ChannelID); ok {
 
 			messageUpdates <- chat_service.MessageUpdate{
 				UpdateTime: m.Timestamp,
 				Update:     chat_service.Edit,
 				Message: chat_service.Message{
-					Source:       chat_service.Discord,
+					Source:       DiscordSource,
 					Id:           m.ID,
 					Author:       discordMsgParser.ParseAuthor(m.Author, m.ChannelID),
 					MessageParts: discordMsgParser.ParseMessage(m.Message),
 					Attachments:  discordMsgParser.ParseAttachment(m.Message),
+					ReplyTo:      discordMsgParser.ParseReplyTo(m.Message),
+					Thread:       thread,
 				},
 				ExtraFields: DiscordInfo{
 					DiscordGuildId:   m.GuildID,
-					DiscordChannelId: m.ChannelID,
+					DiscordChannelId: channelId,
 				},
 			}
 		}
 	})
 
+	client.AddHandler(func(s *dg.Session, m *dg.MessageReactionAdd) {
+		discordEmitter.handleReaction(&discordMsgParser, m.MessageReaction, m.Member, true)
+	})
+
+	client.AddHandler(func(s *dg.Session, m *dg.MessageReactionRemove) {
+		discordEmitter.handleReaction(&discordMsgParser, m.MessageReaction, nil, false)
+	})
+
+	client.AddHandler(func(s *dg.Session, m *dg.MessageReactionRemoveAll) {
+		discordEmitter.handleReactionRemoveAll(&discordMsgParser, m.MessageReaction)
+	})
+
+	// discordgo has no type for the removal of every reaction with an emoji, it is read from the raw event
+	client.AddHandler(func(s *dg.Session, e *dg.Event) {
+		if e.Type != MESSAGE_REACTION_REMOVE_EMOJI_EVENT {
+			return
+		}
+		var reaction dg.MessageReaction
+		if err := json.Unmarshal(e.RawData, &reaction); err != nil {
+			fmt.Printf("Cannot read the %s event: %s\n", MESSAGE_REACTION_REMOVE_EMOJI_EVENT, err.Error())
+			return
+		}
+		discordEmitter.handleReactionRemoveEmoji(&discordMsgParser, &reaction)
+	})
+
 	err = client.Open()
 	if err != nil {
 		return nil, err
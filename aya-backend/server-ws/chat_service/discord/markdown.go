@@ -0,0 +1,258 @@
+package discord_source
+
+import (
+	. "aya-backend/server-ws/chat_service"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MARKDOWN_ESCAPABLE = "\\*_~`|[]()<>#-"
+
+	// URL_REGEX matches the links discord shows, with or without an embed. The markdown
+	// delimiters and the punctuation ending a link are left out, e.g. in **https://x.com**.
+	URL_REGEX = `<https?://[^\s>]+>|https?://[^\s<]*[^\s<*_~|.,:;!?'")\]]`
+)
+
+// markdownTokenRegex matches the tokens whose characters are never markdown delimiters,
+// e.g. the underscores of <:blob_cat:123> or https://x.com/a_b_c
+var markdownTokenRegex = regexp.MustCompile("^(?:" + strings.Join([]string{
+	EMOJI_REGEX, CHANNEL_REGEX, MENTION_REGEX, ROLE_REGEX, TIME_REGEX, URL_REGEX,
+}, "|") + ")")
+
+// markdownRun is a piece of text with the style of every markdown span enclosing it
+type markdownRun struct {
+	text  string
+	style Format
+}
+
+type markdownRule struct {
+	delimiter string
+	apply     func(style *Format)
+	// verbatim content is not parsed further, e.g. inside code
+	verbatim bool
+	// wordBoundary rules cannot start or end within a word, e.g. snake_case_names
+	wordBoundary bool
+}
+
+// the rules are tried in this order, so longer delimiters come before their prefixes
+var markdownRules = []markdownRule{
+	{delimiter: "```", apply: func(style *Format) { style.Code = true }, verbatim: true},
+	{delimiter: "``", apply: func(style *Format) { style.Code = true }, verbatim: true},
+	{delimiter: "`", apply: func(style *Format) { style.Code = true }, verbatim: true},
+	{delimiter: "||", apply: func(style *Format) { style.Spoiler = true }},
+	{delimiter: "**", apply: func(style *Format) { style.Bold = true }},
+	{delimiter: "__", apply: func(style *Format) { style.Underline = true }},
+	{delimiter: "~~", apply: func(style *Format) { style.Strike = true }},
+	{delimiter: "*", apply: func(style *Format) { style.Italic = true }},
+	{delimiter: "_", apply: func(style *Format) { style.Italic = true }, wordBoundary: true},
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func runeBefore(text string, i int) rune {
+	r, _ := utf8.DecodeLastRuneInString(text[:i])
+	return r
+}
+
+func runeAfter(text string, i int) rune {
+	r, _ := utf8.DecodeRuneInString(text[i:])
+	return r
+}
+
+// tokenLength returns the length of the emoji, mention or url starting at i, or 0
+func tokenLength(text string, i int) int {
+	if text[i] != '<' && text[i] != 'h' {
+		return 0
+	}
+	if match := markdownTokenRegex.FindStringIndex(text[i:]); match != nil {
+		return match[1]
+	}
+	return 0
+}
+
+// findClosing returns the index of the delimiter closing the span opened right before start, or -1
+func findClosing(text string, start int, rule markdownRule) int {
+	delimiter := rule.delimiter
+	if rule.verbatim {
+		if start >= len(text) || text[start] == delimiter[0] {
+			// the delimiter is part of a longer one, which is not closed
+			return -1
+		}
+		end := strings.Index(text[start+1:], delimiter)
+		if end == -1 {
+			return -1
+		}
+		return start + 1 + end
+	}
+
+	if start >= len(text) || (len(delimiter) == 1 && unicode.IsSpace(runeAfter(text, start))) {
+		return -1
+	}
+	double := delimiter + delimiter
+	for j := start + 1; j+len(delimiter) <= len(text); j++ {
+		if text[j] == '\\' {
+			// skip the escaped character
+			j++
+			continue
+		}
+		if length := tokenLength(text, j); length > 0 {
+			// the delimiters within a token do not close the span
+			j += length - 1
+			continue
+		}
+		if !strings.HasPrefix(text[j:], delimiter) {
+			continue
+		}
+		if len(delimiter) == 1 && strings.HasPrefix(text[j:], double) {
+			// a double delimiter belongs to another span
+			j++
+			continue
+		}
+		end := j + len(delimiter)
+		if end < len(text) && text[end] == delimiter[0] {
+			// the closing delimiter is the last one of a row, e.g. in ***text***
+			continue
+		}
+		if len(delimiter) == 1 && unicode.IsSpace(runeBefore(text, j)) {
+			continue
+		}
+		if rule.wordBoundary && end < len(text) && isWordRune(runeAfter(text, end)) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+// codeBlockContent removes the language line and the surrounding line breaks of a code block
+func codeBlockContent(content string) string {
+	if lineEnd := strings.Index(content, "\n"); lineEnd != -1 && !strings.ContainsAny(content[:lineEnd], " \t") {
+		content = content[lineEnd+1:]
+	}
+	return strings.Trim(content, "\n")
+}
+
+// matchMaskedLink matches a link like [label](https://example.com) at the start of the text,
+// and returns its label, its url and its length
+func matchMaskedLink(text string) (string, string, int, bool) {
+	labelEnd := strings.Index(text, "](")
+	if labelEnd <= 1 || strings.ContainsAny(text[1:labelEnd], "\n[]") {
+		return "", "", 0, false
+	}
+	urlEnd := strings.Index(text[labelEnd+2:], ")")
+	if urlEnd == -1 {
+		return "", "", 0, false
+	}
+	url := strings.TrimSpace(text[labelEnd+2 : labelEnd+2+urlEnd])
+	url = strings.TrimSuffix(strings.TrimPrefix(url, "<"), ">")
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") || strings.ContainsAny(url, " \n") {
+		return "", "", 0, false
+	}
+	return text[1:labelEnd], url, labelEnd + 2 + urlEnd + 1, true
+}
+
+// parseMarkdown splits the text into runs of the same style, following the markdown dialect of discord.
+// Nested spans are flattened, e.g. "**a *b***" is split into a bold run and a bold and italic run.
+// Emojis, mentions and urls are kept whole in the runs, for the message parser to split them out.
+func parseMarkdown(text string, style Format) []markdownRun {
+	var runs []markdownRun
+	var plain strings.Builder
+	flush := func() {
+		if plain.Len() > 0 {
+			runs = append(runs, markdownRun{text: plain.String(), style: style})
+			plain.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); {
+		if text[i] == '\\' && i+1 < len(text) && strings.IndexByte(MARKDOWN_ESCAPABLE, text[i+1]) != -1 {
+			plain.WriteByte(text[i+1])
+			i += 2
+			continue
+		}
+
+		if length := tokenLength(text, i); length > 0 {
+			plain.WriteString(text[i : i+length])
+			i += length
+			continue
+		}
+
+		if text[i] == '[' && style.Link == "" {
+			if label, url, length, ok := matchMaskedLink(text[i:]); ok {
+				flush()
+				linkStyle := style
+				linkStyle.Link = url
+				runs = append(runs, parseMarkdown(label, linkStyle)...)
+				i += length
+				continue
+			}
+		}
+
+		matched := false
+		for _, rule := range markdownRules {
+			if !strings.HasPrefix(text[i:], rule.delimiter) {
+				continue
+			}
+			if rule.wordBoundary && i > 0 && isWordRune(runeBefore(text, i)) {
+				continue
+			}
+			start := i + len(rule.delimiter)
+			end := findClosing(text, start, rule)
+			if end == -1 {
+				continue
+			}
+			flush()
+			innerStyle := style
+			rule.apply(&innerStyle)
+			inner := text[start:end]
+			if rule.verbatim {
+				if rule.delimiter == "```" {
+					inner = codeBlockContent(inner)
+				} else {
+					inner = strings.TrimSpace(inner)
+				}
+				if inner != "" {
+					runs = append(runs, markdownRun{text: inner, style: innerStyle})
+				}
+			} else {
+				runs = append(runs, parseMarkdown(inner, innerStyle)...)
+			}
+			i = end + len(rule.delimiter)
+			matched = true
+			break
+		}
+		if !matched {
+			plain.WriteByte(text[i])
+			i++
+		}
+	}
+	flush()
+	return runs
+}
+
+// stripMarkdown returns the text without its markdown syntax
+func stripMarkdown(text string) string {
+	var stripped strings.Builder
+	for _, run := range parseMarkdown(text, Format{}) {
+		stripped.WriteString(run.text)
+	}
+	return stripped.String()
+}
+
+// applyStyle sets the style of the run on a message part, keeping the color of the part
+func applyStyle(part MessagePart, style Format) MessagePart {
+	if style == (Format{}) {
+		return part
+	}
+	format := style
+	if part.Format != nil {
+		format.Color = part.Format.Color
+	}
+	part.Format = &format
+	return part
+}
@@ -0,0 +1,188 @@
+package discord_source
+
+import (
+	. "aya-backend/server-ws/chat_service"
+	"fmt"
+	dg "github.com/bwmarrin/discordgo"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var (
+	plain      = Format{}
+	bold       = Format{Bold: true}
+	italic     = Format{Italic: true}
+	strike     = Format{Strike: true}
+	spoiler    = Format{Spoiler: true}
+	code       = Format{Code: true}
+	boldItalic = Format{Bold: true, Italic: true}
+)
+
+func TestParseMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []markdownRun
+	}{
+		{name: "plain text", text: "hello", want: []markdownRun{{"hello", plain}}},
+		{name: "empty text", text: "", want: nil},
+
+		// nested spans
+		{name: "bold", text: "**bold**", want: []markdownRun{{"bold", bold}}},
+		{name: "italic in bold", text: "**a *b***", want: []markdownRun{{"a ", bold}, {"b", boldItalic}}},
+		{name: "bold italic", text: "***both***", want: []markdownRun{{"both", boldItalic}}},
+		{name: "underline in bold", text: "**a __b__**", want: []markdownRun{{"a ", bold}, {"b", Format{Bold: true, Underline: true}}}},
+		{name: "bold in spoiler", text: "||a **b**||", want: []markdownRun{{"a ", spoiler}, {"b", Format{Bold: true, Spoiler: true}}}},
+		{name: "bold in strike", text: "~~a **b** c~~", want: []markdownRun{{"a ", strike}, {"b", Format{Bold: true, Strike: true}}, {" c", strike}}},
+		{name: "italic in underline", text: "__*a*__", want: []markdownRun{{"a", Format{Italic: true, Underline: true}}}},
+		{name: "overlapping spans", text: "**a __b** c__", want: []markdownRun{{"a __b", bold}, {" c__", plain}}},
+
+		// unclosed spans
+		{name: "unclosed bold", text: "**unclosed", want: []markdownRun{{"**unclosed", plain}}},
+		{name: "unclosed underline", text: "__unclosed", want: []markdownRun{{"__unclosed", plain}}},
+		{name: "unclosed strike", text: "~~unclosed", want: []markdownRun{{"~~unclosed", plain}}},
+		{name: "unclosed spoiler", text: "||unclosed", want: []markdownRun{{"||unclosed", plain}}},
+		{name: "unclosed inside closed", text: "**a ~~b**", want: []markdownRun{{"a ~~b", bold}}},
+		{name: "unclosed italic after bold", text: "**a** *b", want: []markdownRun{{"a", bold}, {" *b", plain}}},
+
+		// italic and word boundaries
+		{name: "underscore italic", text: "_it_", want: []markdownRun{{"it", italic}}},
+		{name: "snake case", text: "snake_case_name", want: []markdownRun{{"snake_case_name", plain}}},
+		{name: "star surrounded by spaces", text: "a * b * c", want: []markdownRun{{"a * b * c", plain}}},
+
+		// code
+		{name: "inline code", text: "`**not bold**`", want: []markdownRun{{"**not bold**", code}}},
+		{name: "double backtick code", text: "``a ` b``", want: []markdownRun{{"a ` b", code}}},
+		{name: "code block", text: "```go\nfmt.Println(1)\n```", want: []markdownRun{{"fmt.Println(1)", code}}},
+		{name: "code block without language", text: "```\n**x**\n```", want: []markdownRun{{"**x**", code}}},
+		{name: "code in bold", text: "**a `b`**", want: []markdownRun{{"a ", bold}, {"b", Format{Bold: true, Code: true}}}},
+		{name: "unclosed inline code", text: "a ` b", want: []markdownRun{{"a ` b", plain}}},
+		{name: "unclosed code block", text: "```lone", want: []markdownRun{{"```lone", plain}}},
+
+		// escapes
+		{name: "escaped bold", text: `\*\*not bold\*\*`, want: []markdownRun{{"**not bold**", plain}}},
+		{name: "escaped code", text: "\\`code\\`", want: []markdownRun{{"`code`", plain}}},
+		{name: "escaped delimiter in bold", text: `**a \** b**`, want: []markdownRun{{"a ** b", bold}}},
+		{name: "escaped backslash", text: `\\**x**`, want: []markdownRun{{`\`, plain}, {"x", bold}}},
+		{name: "backslash before a letter", text: `a\b`, want: []markdownRun{{`a\b`, plain}}},
+
+		// mentions and emojis are kept for the message parser
+		{name: "mention in bold", text: "**hi <@123>**", want: []markdownRun{{"hi <@123>", bold}}},
+		{name: "emoji in spoiler", text: "||<:pog:456>||", want: []markdownRun{{"<:pog:456>", spoiler}}},
+		{name: "emoji in code", text: "`<:pog:456>`", want: []markdownRun{{"<:pog:456>", code}}},
+		{name: "emoji with underscores", text: "<:blob_cat:123> and <:a_b:1>", want: []markdownRun{{"<:blob_cat:123> and <:a_b:1>", plain}}},
+		{name: "emoji with underscores in italic", text: "_hi <:blob_cat:123>_", want: []markdownRun{{"hi <:blob_cat:123>", italic}}},
+
+		// urls
+		{name: "url with underscores", text: "https://x.com/a_b_c", want: []markdownRun{{"https://x.com/a_b_c", plain}}},
+		{name: "url with underscores in text", text: "see https://x.com/a_b_c and _this_", want: []markdownRun{{"see https://x.com/a_b_c and ", plain}, {"this", italic}}},
+		{name: "url does not close italic", text: "_see https://x.com/a_b", want: []markdownRun{{"_see https://x.com/a_b", plain}}},
+		{name: "url with stars", text: "https://x.com/*a* b", want: []markdownRun{{"https://x.com/*a* b", plain}}},
+		{name: "url in bold", text: "**https://x.com/a_b**", want: []markdownRun{{"https://x.com/a_b", bold}}},
+		{name: "url without embed", text: "<https://x.com/a_b_c>", want: []markdownRun{{"<https://x.com/a_b_c>", plain}}},
+		{name: "url in code", text: "`https://x.com/a`", want: []markdownRun{{"https://x.com/a", code}}},
+
+		// masked links
+		{name: "masked link", text: "[site](https://example.com)", want: []markdownRun{{"site", Format{Link: "https://example.com"}}}},
+		{name: "bold masked link", text: "**[site](https://example.com)**", want: []markdownRun{{"site", Format{Bold: true, Link: "https://example.com"}}}},
+		{name: "masked link without scheme", text: "[site](example.com)", want: []markdownRun{{"[site](example.com)", plain}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseMarkdown(test.text, Format{})
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseMarkdown(%q) = %+v, want %+v", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseMessageFormatting(t *testing.T) {
+	state := dg.NewState()
+	if err := state.GuildAdd(&dg.Guild{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.MemberAdd(&dg.Member{GuildID: "1", User: &dg.User{ID: "123", Username: "alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	parser := NewParser(&dg.Session{State: state})
+
+	pog := Emoji{Id: "https://cdn.discordapp.com/emojis/456.png", Alt: ":pog:"}
+	tests := []struct {
+		name    string
+		content string
+		want    []MessagePart
+	}{
+		{
+			name:    "mention in bold",
+			content: "**hi <@123>**",
+			want: []MessagePart{
+				{Content: "hi ", Format: &bold},
+				{Content: "@alice", Format: &Format{Color: "#000000", Bold: true}},
+			},
+		},
+		{
+			name:    "unknown mention in italic",
+			content: "*<@999>*",
+			want: []MessagePart{
+				{Content: "@unknown-user", Format: &Format{Color: "#ffffff", Italic: true}},
+			},
+		},
+		{
+			name:    "emoji with underscores",
+			content: "<:blob_cat:123> at https://x.com/a_b_c",
+			want: []MessagePart{
+				{Emoji: &Emoji{Id: "https://cdn.discordapp.com/emojis/123.png", Alt: ":blob_cat:"}},
+				{Content: " at https://x.com/a_b_c"},
+			},
+		},
+		{
+			name:    "emoji in spoiler",
+			content: "||a <:pog:456>||",
+			want: []MessagePart{
+				{Content: "a ", Format: &spoiler},
+				{Emoji: &pog, Format: &spoiler},
+			},
+		},
+		{
+			name:    "emoji and mention in code",
+			content: "`<:pog:456> <@123>`",
+			want: []MessagePart{
+				{Content: "<:pog:456> <@123>", Format: &code},
+			},
+		},
+		{
+			name:    "everyone in underline",
+			content: "__@everyone__ hi",
+			want: []MessagePart{
+				{Content: "@everyone", Format: &Format{Color: "#ffffff", Underline: true}},
+				{Content: " hi"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parser.ParseMessage(&dg.Message{GuildID: "1", ChannelID: "2", Content: test.content})
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseMessage(%q) = %s, want %s", test.content, describeParts(got), describeParts(test.want))
+			}
+		})
+	}
+}
+
+// describeParts prints the emojis and formats of the parts, instead of their pointers
+func describeParts(parts []MessagePart) string {
+	var description strings.Builder
+	for _, part := range parts {
+		fmt.Fprintf(&description, "{%q", part.Content)
+		if part.Emoji != nil {
+			fmt.Fprintf(&description, " emoji:%+v", *part.Emoji)
+		}
+		if part.Format != nil {
+			fmt.Fprintf(&description, " format:%+v", *part.Format)
+		}
+		description.WriteString("}")
+	}
+	return description.String()
+}
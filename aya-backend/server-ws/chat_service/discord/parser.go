@@ -25,6 +25,19 @@ const (
 	MENTION_SPLIT_REGEX = `<@!?([0-9]+)>`
 	ROLE_SPLIT_REGEX    = `<@&([0-9]+)>`
 	TIME_SPLIT_REGEX    = `<t:([0-9]+):?[tTdDfFR]?>`
+
+	REPLY_PREVIEW_LENGTH = 100
+
+	EMOJI_URL_FORMAT          = "https://cdn.discordapp.com/emojis/%s.png"
+	ANIMATED_EMOJI_URL_FORMAT = "https://cdn.discordapp.com/emojis/%s.gif?v=1"
+
+	PROFILE_URL_FORMAT = "https://discord.com/users/%s"
+
+	// MODERATOR_PERMISSIONS are the permissions that make a member a moderator of the channel
+	MODERATOR_PERMISSIONS = dg.PermissionManageMessages | dg.PermissionKickMembers | dg.PermissionBanMembers | dg.PermissionModerateMembers
+
+	SPOILER_PREFIX     = "SPOILER_"
+	STICKER_URL_FORMAT = "https://media.discordapp.net/stickers/%s.%s"
 )
 
 type RegexIndex int
@@ -61,9 +74,9 @@ func getEmojiInfo(emojiStr string) Emoji {
 	alt := items[2]
 
 	if items[1] == "" {
-		id = fmt.Sprintf("https://cdn.discordapp.com/emojis/%s.png", id)
+		id = fmt.Sprintf(EMOJI_URL_FORMAT, id)
 	} else {
-		id = fmt.Sprintf("https://cdn.discordapp.com/emojis/%s.gif?v=1", id)
+		id = fmt.Sprintf(ANIMATED_EMOJI_URL_FORMAT, id)
 	}
 
 	return Emoji{
@@ -73,6 +86,24 @@ func getEmojiInfo(emojiStr string) Emoji {
 
 }
 
+// ParseReactionEmoji converts the emoji of a reaction. Unicode emojis have no id,
+// so only their alt text is set.
+func (parser *DiscordMessageParser) ParseReactionEmoji(emoji *dg.Emoji) Emoji {
+	if emoji.ID == "" {
+		return Emoji{
+			Alt: emoji.Name,
+		}
+	}
+	urlFormat := EMOJI_URL_FORMAT
+	if emoji.Animated {
+		urlFormat = ANIMATED_EMOJI_URL_FORMAT
+	}
+	return Emoji{
+		Id:  fmt.Sprintf(urlFormat, emoji.ID),
+		Alt: fmt.Sprintf(":%s:", emoji.Name),
+	}
+}
+
 func getTimeStamp(timeStr string) string {
 	items := regexp.MustCompile(TIME_SPLIT_REGEX).FindStringSubmatch(timeStr)
 	if items == nil {
@@ -222,17 +253,91 @@ func NewParser(client *dg.Session) DiscordMessageParser {
 	}
 }
 
+var stickerFormatToExtension = map[dg.StickerFormat]string{
+	dg.StickerFormatTypePNG:    "png",
+	dg.StickerFormatTypeAPNG:   "png",
+	dg.StickerFormatTypeLottie: "json",
+	dg.StickerFormatTypeGIF:    "gif",
+}
+
+var stickerFormatToContentType = map[dg.StickerFormat]string{
+	dg.StickerFormatTypePNG:    "image/png",
+	dg.StickerFormatTypeAPNG:   "image/apng",
+	dg.StickerFormatTypeLottie: "application/json",
+	dg.StickerFormatTypeGIF:    "image/gif",
+}
+
+func parseEmbedImage(image *dg.MessageEmbedImage) Attachment {
+	return Attachment{
+		Url:      image.URL,
+		ProxyUrl: image.ProxyURL,
+		Width:    image.Width,
+		Height:   image.Height,
+	}
+}
+
+// ParseAttachment collects the files, stickers and embedded media of the message
 func (parser *DiscordMessageParser) ParseAttachment(message *dg.Message) []Attachment {
 	var attachments []Attachment
 	for _, msgAttachment := range message.Attachments {
-		attachments = append(attachments, Attachment(msgAttachment.Filename))
+		attachments = append(attachments, Attachment{
+			Url:         msgAttachment.URL,
+			ProxyUrl:    msgAttachment.ProxyURL,
+			Filename:    msgAttachment.Filename,
+			ContentType: msgAttachment.ContentType,
+			Width:       msgAttachment.Width,
+			Height:      msgAttachment.Height,
+			Size:        msgAttachment.Size,
+			Spoiler:     strings.HasPrefix(msgAttachment.Filename, SPOILER_PREFIX),
+		})
+	}
+	for _, sticker := range message.StickerItems {
+		extension, ok := stickerFormatToExtension[sticker.FormatType]
+		if !ok {
+			continue
+		}
+		attachments = append(attachments, Attachment{
+			Url:         fmt.Sprintf(STICKER_URL_FORMAT, sticker.ID, extension),
+			Filename:    sticker.Name,
+			ContentType: stickerFormatToContentType[sticker.FormatType],
+		})
+	}
+	for _, embed := range message.Embeds {
+		switch {
+		case embed.Type == dg.EmbedTypeGifv && embed.Video != nil:
+			attachments = append(attachments, Attachment{
+				Url:         embed.Video.URL,
+				ContentType: "video/mp4",
+				Width:       embed.Video.Width,
+				Height:      embed.Video.Height,
+			})
+		case embed.Image != nil:
+			attachments = append(attachments, parseEmbedImage(embed.Image))
+		case embed.Type == dg.EmbedTypeImage && embed.Thumbnail != nil:
+			attachments = append(attachments, parseEmbedImage((*dg.MessageEmbedImage)(embed.Thumbnail)))
+		default:
+		}
 	}
 	return attachments
 }
 
+// ParseMessage splits the content of the message into formatted parts.
+// Mentions, emojis and timestamps are parsed everywhere but in code.
 func (parser *DiscordMessageParser) ParseMessage(message *dg.Message) []MessagePart {
+	var messageParts []MessagePart
+	for _, run := range parseMarkdown(message.Content, Format{}) {
+		if run.style.Code {
+			messageParts = append(messageParts, applyStyle(MessagePart{Content: run.text}, run.style))
+			continue
+		}
+		for _, part := range parser.parseContent(message, run.text) {
+			messageParts = append(messageParts, applyStyle(part, run.style))
+		}
+	}
+	return messageParts
+}
 
-	msgContent := message.Content
+func (parser *DiscordMessageParser) parseContent(message *dg.Message, msgContent string) []MessagePart {
 	delimiters := parser.compiledUltRegex.FindAllStringSubmatch(msgContent, -1)
 
 	contents := parser.compiledUltRegex.Split(msgContent, -1)
@@ -259,23 +364,131 @@ func (parser *DiscordMessageParser) ParseMessage(message *dg.Message) []MessageP
 	return messageParts
 }
 
-func (parser *DiscordMessageParser) ParseAuthor(author *dg.User, channelId string) Author {
-
-	color := parser.client.State.UserColor(author.ID, channelId)
+// getMember returns the guild member of the user in the guild of the channel, or nil if not cached
+func (parser *DiscordMessageParser) getMember(userId string, channelId string) *dg.Member {
+	channel, err := parser.client.State.Channel(channelId)
+	if err != nil {
+		return nil
+	}
+	member, err := parser.client.State.Member(channel.GuildID, userId)
+	if err != nil {
+		return nil
+	}
+	return member
+}
 
+func (parser *DiscordMessageParser) ParseAuthor(author *dg.User, channelId string) Author {
+	isBot := author.Bot
 	user, err := parser.client.User(author.ID)
 	if err != nil {
 		fmt.Println(err.Error())
+	} else {
+		isBot = user.Bot
+	}
+	return parser.parseCachedAuthor(author, isBot, channelId)
+}
+
+// ParseBadges gives the owner of the guild the owner badge, and the members who can moderate
+// the channel the moderator badge, so that they match the roles of the other sources
+func (parser *DiscordMessageParser) ParseBadges(userId string, userPerm int64, channelId string) []Badge {
+	if channel, err := parser.client.State.Channel(channelId); err == nil {
+		if guild, err := parser.client.State.Guild(channel.GuildID); err == nil && guild.OwnerID == userId {
+			return []Badge{{Name: "owner"}}
+		}
 	}
+	if userPerm&MODERATOR_PERMISSIONS != 0 {
+		return []Badge{{Name: "moderator"}}
+	}
+	return nil
+}
+
+// parseCachedAuthor returns the author info from the user and the state cache only,
+// for the users that are parsed often enough that a request each time would be too much
+func (parser *DiscordMessageParser) parseCachedAuthor(author *dg.User, isBot bool, channelId string) Author {
+	color := parser.client.State.UserColor(author.ID, channelId)
+
 	userPerm, err := parser.client.State.UserChannelPermissions(author.ID, channelId)
 	if err != nil {
 		fmt.Println(err.Error())
 	}
 
+	displayName := author.Username
+	avatarUrl := author.AvatarURL("")
+	if member := parser.getMember(author.ID, channelId); member != nil {
+		if member.Nick != "" {
+			displayName = member.Nick
+		}
+		// members can set a different avatar in each guild
+		if member.Avatar != "" {
+			avatarUrl = member.AvatarURL("")
+		}
+	}
+
 	return Author{
-		Username: author.Username,
-		IsAdmin:  (userPerm & dg.PermissionAdministrator) != 0,
-		IsBot:    user.Bot,
-		Color:    fmt.Sprintf("#%06x", color),
+		Id:          author.ID,
+		Username:    author.Username,
+		DisplayName: displayName,
+		AvatarUrl:   avatarUrl,
+		ProfileUrl:  fmt.Sprintf(PROFILE_URL_FORMAT, author.ID),
+		IsAdmin:     (userPerm & dg.PermissionAdministrator) != 0,
+		IsBot:       isBot,
+		Color:       fmt.Sprintf("#%06x", color),
+		Badges:      parser.ParseBadges(author.ID, userPerm, channelId),
+	}
+}
+
+// ParseReactionUser returns the author info of the user reacting to a message.
+// The member is only sent by discord when a reaction is added, otherwise it is read
+// from the state cache. Only the id is known of the users missing from the cache,
+// since fetching them would cost a request per reaction.
+func (parser *DiscordMessageParser) ParseReactionUser(reaction *dg.MessageReaction, member *dg.Member) Author {
+	if member != nil && member.User != nil {
+		return parser.parseCachedAuthor(member.User, member.User.Bot, reaction.ChannelID)
+	}
+	if member, err := parser.client.State.Member(reaction.GuildID, reaction.UserID); err == nil && member.User != nil {
+		return parser.parseCachedAuthor(member.User, member.User.Bot, reaction.ChannelID)
+	}
+	return Author{
+		Id:         reaction.UserID,
+		ProfileUrl: fmt.Sprintf(PROFILE_URL_FORMAT, reaction.UserID),
+	}
+}
+
+// ParseReplyTo returns the message that the message is replying to, or nil if it is not a reply.
+// Other messages also reference a message, such as the forwarded ones or the thread starters.
+// The author of the referenced message is parsed from the event and the state cache only.
+func (parser *DiscordMessageParser) ParseReplyTo(message *dg.Message) *ReplyTo {
+	if message.Type != dg.MessageTypeReply || message.MessageReference == nil || message.MessageReference.MessageID == "" {
+		return nil
+	}
+	replyTo := ReplyTo{
+		Id: message.MessageReference.MessageID,
+	}
+	// the referenced message is missing when it has been deleted
+	if referencedMessage := message.ReferencedMessage; referencedMessage != nil {
+		if referencedMessage.Author != nil {
+			author := parser.parseCachedAuthor(referencedMessage.Author, referencedMessage.Author.Bot, referencedMessage.ChannelID)
+			replyTo.Author = &author
+		}
+		replyTo.Preview = TruncateText(stripMarkdown(referencedMessage.ContentWithMentionsReplaced()), REPLY_PREVIEW_LENGTH)
+	}
+	return &replyTo
+}
+
+// ParseThread returns the thread of the channel, or nil if the channel is not a thread.
+// Only the state cache is read, which the gateway fills with the threads of the guilds,
+// so that the events of the channels nobody subscribes to do not cost any request.
+func (parser *DiscordMessageParser) ParseThread(channelId string) *Thread {
+	channel, err := parser.client.State.Channel(channelId)
+	if err != nil {
+		return nil
+	}
+	if !channel.IsThread() {
+		return nil
+	}
+	return &Thread{
+		Id:       channel.ID,
+		Name:     channel.Name,
+		ParentId: channel.ParentID,
 	}
 }
@@ -0,0 +1,117 @@
+package discord_source
+
+import (
+	dg "github.com/bwmarrin/discordgo"
+	"testing"
+)
+
+func TestParseReplyTo(t *testing.T) {
+	state := newTestState(t, &dg.Message{ID: "10", ChannelID: "2", GuildID: "1"})
+	parser := NewParser(&dg.Session{State: state})
+	reference := &dg.MessageReference{MessageID: "10", ChannelID: "2", GuildID: "1"}
+	referenced := &dg.Message{ID: "10", ChannelID: "2", Content: "hello **there**", Author: &dg.User{ID: "9", Username: "alice"}}
+
+	tests := []struct {
+		name        string
+		message     *dg.Message
+		wantReply   bool
+		wantAuthor  string
+		wantPreview string
+	}{
+		{
+			name:        "reply",
+			message:     &dg.Message{Type: dg.MessageTypeReply, MessageReference: reference, ReferencedMessage: referenced},
+			wantReply:   true,
+			wantAuthor:  "alice",
+			wantPreview: "hello there",
+		},
+		{
+			name:      "reply to a deleted message",
+			message:   &dg.Message{Type: dg.MessageTypeReply, MessageReference: reference},
+			wantReply: true,
+		},
+		{
+			name:    "forwarded message",
+			message: &dg.Message{Type: dg.MessageTypeDefault, MessageReference: reference, ReferencedMessage: referenced},
+		},
+		{
+			name:    "thread starter",
+			message: &dg.Message{Type: dg.MessageTypeThreadStarterMessage, MessageReference: reference, ReferencedMessage: referenced},
+		},
+		{
+			name:    "plain message",
+			message: &dg.Message{Type: dg.MessageTypeDefault},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			replyTo := parser.ParseReplyTo(test.message)
+			if !test.wantReply {
+				if replyTo != nil {
+					t.Errorf("message replies to %v", replyTo)
+				}
+				return
+			}
+			if replyTo == nil || replyTo.Id != "10" {
+				t.Fatalf("reply to = %v, want message 10", replyTo)
+			}
+			if test.wantAuthor == "" {
+				if replyTo.Author != nil {
+					t.Errorf("author = %v, want none", replyTo.Author)
+				}
+			} else if replyTo.Author == nil || replyTo.Author.Username != test.wantAuthor {
+				t.Errorf("author = %v, want %s", replyTo.Author, test.wantAuthor)
+			}
+			if replyTo.Preview != test.wantPreview {
+				t.Errorf("preview = %q, want %q", replyTo.Preview, test.wantPreview)
+			}
+		})
+	}
+}
+
+func TestParseAuthorBadges(t *testing.T) {
+	state := dg.NewState()
+	guild := &dg.Guild{ID: "1", OwnerID: "7", Roles: []*dg.Role{
+		{ID: "1", Permissions: dg.PermissionSendMessages},
+		{ID: "20", Permissions: dg.PermissionManageMessages},
+	}}
+	if err := state.GuildAdd(guild); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.ChannelAdd(&dg.Channel{ID: "2", GuildID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, member := range []*dg.Member{
+		{GuildID: "1", User: &dg.User{ID: "7", Username: "owner"}},
+		{GuildID: "1", User: &dg.User{ID: "8", Username: "mod"}, Roles: []string{"20"}},
+		{GuildID: "1", User: &dg.User{ID: "9", Username: "alice"}},
+	} {
+		if err := state.MemberAdd(member); err != nil {
+			t.Fatal(err)
+		}
+	}
+	parser := NewParser(&dg.Session{State: state})
+
+	tests := []struct {
+		userId    string
+		wantBadge string
+	}{
+		{userId: "7", wantBadge: "owner"},
+		{userId: "8", wantBadge: "moderator"},
+		{userId: "9"},
+	}
+	for _, test := range tests {
+		member, err := state.Member("1", test.userId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		author := parser.parseCachedAuthor(member.User, false, "2")
+		if test.wantBadge == "" {
+			if len(author.Badges) != 0 {
+				t.Errorf("%s badges = %v, want none", member.User.Username, author.Badges)
+			}
+		} else if len(author.Badges) != 1 || author.Badges[0].Name != test.wantBadge {
+			t.Errorf("%s badges = %v, want %s", member.User.Username, author.Badges, test.wantBadge)
+		}
+	}
+}
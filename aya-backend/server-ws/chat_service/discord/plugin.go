@@ -0,0 +1,60 @@
+package discord_source
+
+import (
+	"aya-backend/server-ws/chat_service"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	DiscordSource chat_service.Source = "discord"
+
+	DISCORD_TOKEN_ENV = "DISCORD_TOKEN"
+)
+
+type discordPlugin struct{}
+
+func init() {
+	chat_service.RegisterSource(discordPlugin{})
+}
+
+func (discordPlugin) Source() chat_service.Source {
+	return DiscordSource
+}
+
+func (discordPlugin) DecodeResourceInfo(data []byte) (any, error) {
+	var discordInfo DiscordInfo
+	if err := json.Unmarshal(data, &discordInfo); err != nil {
+		return nil, err
+	}
+	return discordInfo, nil
+}
+
+func (discordPlugin) ValidateResourceInfo(resourceInfo any) error {
+	discordInfo, ok := resourceInfo.(DiscordInfo)
+	if !ok {
+		return fmt.Errorf("resource info is not a discord resource")
+	}
+	if discordInfo.DiscordGuildId == "" || discordInfo.DiscordChannelId == "" {
+		return fmt.Errorf("discord guild id and channel id are required")
+	}
+	return nil
+}
+
+func (discordPlugin) ResourceKey(resourceInfo any) (string, error) {
+	discordInfo, ok := resourceInfo.(DiscordInfo)
+	if !ok {
+		return "", fmt.Errorf("resource info is not a discord resource")
+	}
+	return fmt.Sprintf("%s/%s", discordInfo.DiscordGuildId, discordInfo.DiscordChannelId), nil
+}
+
+func (discordPlugin) NewEmitter(config chat_service.EmitterConfig) (chat_service.SourceEmitter, error) {
+	discordToken := os.Getenv(DISCORD_TOKEN_ENV)
+	discordEmitter, err := NewEmitter(discordToken)
+	if err != nil {
+		return nil, err
+	}
+	return discordEmitter, nil
+}
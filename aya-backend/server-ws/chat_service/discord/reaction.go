@@ -0,0 +1,210 @@
+package discord_source
+
+import (
+	"aya-backend/server-ws/chat_service"
+	dg "github.com/bwmarrin/discordgo"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	REACTION_TRACKED_MESSAGES = 500
+	// STATE_MESSAGES_PER_CHANNEL is how many messages of each channel the state cache keeps,
+	// which the reaction counts start from
+	STATE_MESSAGES_PER_CHANNEL = 100
+
+	MESSAGE_REACTION_REMOVE_EMOJI_EVENT = "MESSAGE_REACTION_REMOVE_EMOJI"
+)
+
+// reactionCounter keeps the reaction counts of the most recent messages that got reactions.
+// Discord only sends the reaction that changed, so the counts of a message start from those
+// of the message in the state cache the first time one of its reactions changes, and are then
+// kept up to date from the events. The counts of a message missing from the cache start from
+// zero, since fetching it would cost a request per reaction.
+type reactionCounter struct {
+	mutex       sync.Mutex
+	client      *dg.Session
+	maxMessages int
+	// reaction counts of each message, in the order the emojis were first used
+	messageReactions map[string][]*dg.MessageReactions
+	// ids of the counted messages, oldest first
+	messageOrder []string
+}
+
+func newReactionCounter(client *dg.Session, maxMessages int) *reactionCounter {
+	return &reactionCounter{
+		client:           client,
+		maxMessages:      maxMessages,
+		messageReactions: make(map[string][]*dg.MessageReactions),
+	}
+}
+
+// copyReactions copies the counts so that they can be read without holding the mutex
+func copyReactions(reactions []*dg.MessageReactions) []*dg.MessageReactions {
+	copied := make([]*dg.MessageReactions, 0, len(reactions))
+	for _, reaction := range reactions {
+		reactionCopy := *reaction
+		copied = append(copied, &reactionCopy)
+	}
+	return copied
+}
+
+func emojiKey(emoji *dg.Emoji) string {
+	if emoji.ID != "" {
+		return emoji.ID
+	}
+	return emoji.Name
+}
+
+// store keeps the counts of a message that was not counted yet.
+// Must be called with the mutex held.
+func (counter *reactionCounter) store(messageId string, reactions []*dg.MessageReactions) {
+	counter.messageReactions[messageId] = reactions
+	counter.messageOrder = append(counter.messageOrder, messageId)
+	if len(counter.messageOrder) > counter.maxMessages {
+		delete(counter.messageReactions, counter.messageOrder[0])
+		counter.messageOrder = counter.messageOrder[1:]
+	}
+}
+
+// counts returns the counts of the message, which start from those of the state cache
+// when the message was not counted yet. Must be called with the mutex held.
+func (counter *reactionCounter) counts(channelId string, messageId string) []*dg.MessageReactions {
+	if reactions, ok := counter.messageReactions[messageId]; ok {
+		return reactions
+	}
+	var reactions []*dg.MessageReactions
+	if message, err := counter.client.State.Message(channelId, messageId); err == nil {
+		// the cached counts are copied, since they are changed by the events
+		reactions = copyReactions(message.Reactions)
+	}
+	counter.store(messageId, reactions)
+	return reactions
+}
+
+// update applies the change to the counts of the message and returns the new counts
+func (counter *reactionCounter) update(reaction *dg.MessageReaction, added bool) []*dg.MessageReactions {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	reactions := counter.counts(reaction.ChannelID, reaction.MessageID)
+
+	key := emojiKey(&reaction.Emoji)
+	idx := slices.IndexFunc(reactions, func(messageReactions *dg.MessageReactions) bool {
+		return messageReactions.Emoji != nil && emojiKey(messageReactions.Emoji) == key
+	})
+	switch {
+	case idx == -1 && added:
+		emoji := reaction.Emoji
+		reactions = append(reactions, &dg.MessageReactions{
+			Count: 1,
+			Emoji: &emoji,
+		})
+	case idx == -1:
+		// the removed reaction was not counted
+	case added:
+		reactions[idx].Count++
+	default:
+		reactions[idx].Count--
+		if reactions[idx].Count <= 0 {
+			reactions = slices.Delete(reactions, idx, idx+1)
+		}
+	}
+	counter.messageReactions[reaction.MessageID] = reactions
+	return copyReactions(reactions)
+}
+
+// removeEmoji removes every reaction with the emoji from the message and returns the new counts
+func (counter *reactionCounter) removeEmoji(reaction *dg.MessageReaction) []*dg.MessageReactions {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	reactions := counter.counts(reaction.ChannelID, reaction.MessageID)
+
+	key := emojiKey(&reaction.Emoji)
+	reactions = slices.DeleteFunc(reactions, func(messageReactions *dg.MessageReactions) bool {
+		return messageReactions.Emoji != nil && emojiKey(messageReactions.Emoji) == key
+	})
+	counter.messageReactions[reaction.MessageID] = reactions
+	return copyReactions(reactions)
+}
+
+// clear removes every reaction of the message
+func (counter *reactionCounter) clear(messageId string) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	if _, ok := counter.messageReactions[messageId]; ok {
+		counter.messageReactions[messageId] = nil
+	} else {
+		counter.store(messageId, nil)
+	}
+}
+
+func (parser *DiscordMessageParser) ParseReactions(reactions []*dg.MessageReactions) []chat_service.MessageReaction {
+	messageReactions := make([]chat_service.MessageReaction, 0, len(reactions))
+	for _, reaction := range reactions {
+		if reaction.Emoji == nil {
+			continue
+		}
+		messageReactions = append(messageReactions, chat_service.MessageReaction{
+			Emoji: parser.ParseReactionEmoji(reaction.Emoji),
+			Count: reaction.Count,
+		})
+	}
+	return messageReactions
+}
+
+// newReactionUpdate builds the reaction update of a message. The reaction change is nil
+// when the reactions are cleared, all of them or those with an emoji.
+func newReactionUpdate(
+	reaction *dg.MessageReaction,
+	channelId string,
+	reactions []chat_service.MessageReaction,
+	change *chat_service.ReactionChange,
+) chat_service.MessageUpdate {
+	return chat_service.MessageUpdate{
+		// discord does not send the time of reactions
+		UpdateTime: time.Now(),
+		Update:     chat_service.Reaction,
+		Message: chat_service.Message{
+			Source:    DiscordSource,
+			Id:        reaction.MessageID,
+			Reactions: reactions,
+		},
+		Reaction: change,
+		ExtraFields: DiscordInfo{
+			DiscordGuildId:   reaction.GuildID,
+			DiscordChannelId: channelId,
+		},
+	}
+}
+
+func (emitter *DiscordEmitter) handleReaction(parser *DiscordMessageParser, reaction *dg.MessageReaction, member *dg.Member, added bool) {
+	channelId, _, ok := emitter.matchChannel(parser, reaction.GuildID, reaction.ChannelID)
+	if !ok {
+		return
+	}
+	reactions := emitter.reactions.update(reaction, added)
+	emitter.updateEmitter <- newReactionUpdate(reaction, channelId, parser.ParseReactions(reactions), &chat_service.ReactionChange{
+		Emoji: parser.ParseReactionEmoji(&reaction.Emoji),
+		User:  parser.ParseReactionUser(reaction, member),
+		Added: added,
+	})
+}
+
+func (emitter *DiscordEmitter) handleReactionRemoveAll(parser *DiscordMessageParser, reaction *dg.MessageReaction) {
+	channelId, _, ok := emitter.matchChannel(parser, reaction.GuildID, reaction.ChannelID)
+	if !ok {
+		return
+	}
+	emitter.reactions.clear(reaction.MessageID)
+	emitter.updateEmitter <- newReactionUpdate(reaction, channelId, []chat_service.MessageReaction{}, nil)
+}
+
+func (emitter *DiscordEmitter) handleReactionRemoveEmoji(parser *DiscordMessageParser, reaction *dg.MessageReaction) {
+	channelId, _, ok := emitter.matchChannel(parser, reaction.GuildID, reaction.ChannelID)
+	if !ok {
+		return
+	}
+	reactions := emitter.reactions.removeEmoji(reaction)
+	emitter.updateEmitter <- newReactionUpdate(reaction, channelId, parser.ParseReactions(reactions), nil)
+}
@@ -0,0 +1,104 @@
+package discord_source
+
+import (
+	. "aya-backend/server-ws/chat_service"
+	"encoding/json"
+	dg "github.com/bwmarrin/discordgo"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestState returns a state cache with a guild, a channel and a message of the channel
+func newTestState(t *testing.T, message *dg.Message) *dg.State {
+	t.Helper()
+	state := dg.NewState()
+	state.MaxMessageCount = STATE_MESSAGES_PER_CHANNEL
+	if err := state.GuildAdd(&dg.Guild{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.ChannelAdd(&dg.Channel{ID: "2", GuildID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.MessageAdd(message); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func testReaction(messageId string, emojiName string) *dg.MessageReaction {
+	return &dg.MessageReaction{UserID: "9", MessageID: messageId, ChannelID: "2", GuildID: "1", Emoji: dg.Emoji{Name: emojiName}}
+}
+
+func reactionCounts(reactions []*dg.MessageReactions) map[string]int {
+	counts := make(map[string]int)
+	for _, reaction := range reactions {
+		counts[reaction.Emoji.Name] = reaction.Count
+	}
+	return counts
+}
+
+func TestReactionCounter(t *testing.T) {
+	cachedMessage := &dg.Message{ID: "10", ChannelID: "2", GuildID: "1", Reactions: []*dg.MessageReactions{
+		{Count: 2, Emoji: &dg.Emoji{Name: "a"}},
+	}}
+	state := newTestState(t, cachedMessage)
+	counter := newReactionCounter(&dg.Session{State: state}, 2)
+
+	// the counts of a cached message start from those of the cache
+	if got := reactionCounts(counter.update(testReaction("10", "a"), true)); !reflect.DeepEqual(got, map[string]int{"a": 3}) {
+		t.Errorf("cached message counts = %v", got)
+	}
+	if cachedMessage.Reactions[0].Count != 2 {
+		t.Errorf("the counts of the cache are changed to %d", cachedMessage.Reactions[0].Count)
+	}
+	// the counts of a message missing from the cache start from zero
+	if got := reactionCounts(counter.update(testReaction("11", "b"), true)); !reflect.DeepEqual(got, map[string]int{"b": 1}) {
+		t.Errorf("missing message counts = %v", got)
+	}
+	if got := reactionCounts(counter.update(testReaction("11", "b"), false)); len(got) != 0 {
+		t.Errorf("counts after the removal = %v", got)
+	}
+	counter.update(testReaction("10", "c"), true)
+	if got := reactionCounts(counter.removeEmoji(testReaction("10", "a"))); !reflect.DeepEqual(got, map[string]int{"c": 1}) {
+		t.Errorf("counts after the emoji removal = %v", got)
+	}
+	counter.clear("10")
+	if got := reactionCounts(counter.update(testReaction("10", "c"), true)); !reflect.DeepEqual(got, map[string]int{"c": 1}) {
+		t.Errorf("counts after the clear = %v", got)
+	}
+
+	// only the most recent messages are counted
+	counter.update(testReaction("12", "d"), true)
+	if _, ok := counter.messageReactions["10"]; ok {
+		t.Error("the oldest message is still counted")
+	}
+}
+
+func TestParseReactionUserFromState(t *testing.T) {
+	state := newTestState(t, &dg.Message{ID: "10", ChannelID: "2", GuildID: "1"})
+	if err := state.MemberAdd(&dg.Member{GuildID: "1", User: &dg.User{ID: "9", Username: "alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	parser := NewParser(&dg.Session{State: state})
+
+	if user := parser.ParseReactionUser(testReaction("10", "a"), nil); user.Username != "alice" {
+		t.Errorf("cached user = %v, want alice", user)
+	}
+	reaction := testReaction("10", "a")
+	reaction.UserID = "8"
+	if user := parser.ParseReactionUser(reaction, nil); user.Id != "8" || user.Username != "" {
+		t.Errorf("missing user = %v, want only its id", user)
+	}
+}
+
+func TestClearedReactionsAreSent(t *testing.T) {
+	update := newReactionUpdate(testReaction("10", "a"), "2", []MessageReaction{}, nil)
+	data, err := json.Marshal(update.Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"reactions":[]`) {
+		t.Errorf("cleared reactions are not sent: %s", data)
+	}
+}
@@ -0,0 +1,64 @@
+package chat_service
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// ProtocolVersion is the version of the format the updates are sent to the clients in.
+type ProtocolVersion int
+
+const (
+	// ProtocolV1 sends each attachment as its filename
+	ProtocolV1 ProtocolVersion = 1
+	// ProtocolV2 sends each attachment as an object with its url, content type and size
+	ProtocolV2 ProtocolVersion = 2
+
+	DefaultProtocolVersion = ProtocolV1
+	LatestProtocolVersion  = ProtocolV2
+)
+
+func ParseProtocolVersion(s string) (ProtocolVersion, error) {
+	version, err := strconv.Atoi(s)
+	if err != nil || version < int(ProtocolV1) || version > int(LatestProtocolVersion) {
+		return ProtocolVersion(-1), fmt.Errorf(`cannot detect "%s", not a valid protocol version`, s)
+	}
+	return ProtocolVersion(version), nil
+}
+
+// The legacy types shadow a field of the type they embed. The shadowing field comes first and
+// the embedded type is inlined explicitly, since msgpack only skips the shadowed fields this way.
+type legacyMessage struct {
+	Attachments []string `json:"attachments"`
+	Message     `msgpack:",inline"`
+}
+
+type legacyMessageUpdate struct {
+	Message       legacyMessage `json:"message"`
+	MessageUpdate `msgpack:",inline"`
+}
+
+func (attachment Attachment) legacyString() string {
+	if attachment.Filename != "" {
+		return attachment.Filename
+	}
+	return attachment.Url
+}
+
+// ForProtocol returns the value to marshal when sending the update with the given protocol version
+func (msgUpdate MessageUpdate) ForProtocol(version ProtocolVersion) any {
+	if version >= ProtocolV2 {
+		return msgUpdate
+	}
+	attachments := make([]string, 0, len(msgUpdate.Message.Attachments))
+	for _, attachment := range msgUpdate.Message.Attachments {
+		attachments = append(attachments, attachment.legacyString())
+	}
+	return legacyMessageUpdate{
+		MessageUpdate: msgUpdate,
+		Message: legacyMessage{
+			Message:     msgUpdate.Message,
+			Attachments: attachments,
+		},
+	}
+}
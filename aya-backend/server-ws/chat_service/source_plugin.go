@@ -0,0 +1,82 @@
+package chat_service
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"slices"
+	"sync"
+)
+
+// SourceEmitter is the emitter of a chat source. Sessions subscribe to the
+// resources of the source through the ResourceRegister.
+type SourceEmitter interface {
+	ChatEmitter
+	ResourceRegister
+}
+
+type EmitterConfig struct {
+	// AuthRouter is the router on which the source can set up its auth workflow
+	AuthRouter *mux.Router
+	// AuthRedirectBasedUrl is the public url of AuthRouter
+	AuthRedirectBasedUrl string
+}
+
+// SourcePlugin describes everything the server needs to know about a chat source.
+// A source registers its plugin with RegisterSource, usually from an init function.
+type SourcePlugin interface {
+	// Source returns the name of the source, as used in the resources and messages
+	Source() Source
+	// DecodeResourceInfo parses the JSON resource info of the source
+	DecodeResourceInfo(data []byte) (any, error)
+	// ValidateResourceInfo checks that the decoded resource info can be subscribed to
+	ValidateResourceInfo(resourceInfo any) error
+	// ResourceKey returns a string that identifies the resource within the source
+	ResourceKey(resourceInfo any) (string, error)
+	// NewEmitter creates the emitter of the source
+	NewEmitter(config EmitterConfig) (SourceEmitter, error)
+}
+
+var (
+	sourcePluginsMutex sync.RWMutex
+	sourcePlugins      = make(map[Source]SourcePlugin)
+)
+
+// RegisterSource makes a source available to the server. It panics if the
+// source is registered twice.
+func RegisterSource(plugin SourcePlugin) {
+	sourcePluginsMutex.Lock()
+	defer sourcePluginsMutex.Unlock()
+	source := plugin.Source()
+	if _, ok := sourcePlugins[source]; ok {
+		panic(fmt.Sprintf("source \"%s\" is already registered", source))
+	}
+	sourcePlugins[source] = plugin
+}
+
+func GetSourcePlugin(source Source) (SourcePlugin, bool) {
+	sourcePluginsMutex.RLock()
+	defer sourcePluginsMutex.RUnlock()
+	plugin, ok := sourcePlugins[source]
+	return plugin, ok
+}
+
+// RegisteredSources returns the name of every registered source, sorted
+func RegisteredSources() []Source {
+	sourcePluginsMutex.RLock()
+	defer sourcePluginsMutex.RUnlock()
+	sources := make([]Source, 0, len(sourcePlugins))
+	for source := range sourcePlugins {
+		sources = append(sources, source)
+	}
+	slices.Sort(sources)
+	return sources
+}
+
+// GetResourceKey returns the key of the resource info from the plugin of the source
+func GetResourceKey(source Source, resourceInfo any) (string, error) {
+	plugin, ok := GetSourcePlugin(source)
+	if !ok {
+		return "", fmt.Errorf("source \"%s\" is not registered", source)
+	}
+	return plugin.ResourceKey(resourceInfo)
+}
@@ -0,0 +1,10 @@
+// Package sources registers every chat source of the server.
+// Import it for its side effects before looking up a chat_service.SourcePlugin.
+package sources
+
+import (
+	_ "aya-backend/server-ws/chat_service/discord"
+	_ "aya-backend/server-ws/chat_service/test_source"
+	_ "aya-backend/server-ws/chat_service/twitch"
+	_ "aya-backend/server-ws/chat_service/youtube"
+)
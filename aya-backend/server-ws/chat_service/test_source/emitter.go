@@ -8,6 +8,7 @@ import (
 
 type TestEmitter struct {
 	ChatEmitter
+	ResourceRegister
 	updateEmitter chan MessageUpdate
 	errorEmitter  chan error
 }
@@ -16,6 +17,14 @@ func (testEmitter *TestEmitter) UpdateEmitter() chan MessageUpdate {
 	return testEmitter.updateEmitter
 }
 
+// Register does nothing, since the test messages are generated for every subscriber
+func (testEmitter *TestEmitter) Register(subscriber string, resourceInfo any) {
+}
+
+// Deregister does nothing, since the test messages are generated for every subscriber
+func (testEmitter *TestEmitter) Deregister(subscriber string, resourceInfo any) {
+}
+
 func (testEmitter *TestEmitter) CloseEmitter() error {
 	close(testEmitter.updateEmitter)
 	return nil
@@ -40,6 +49,7 @@ func NewEmitter() *TestEmitter {
 					Source: TestSource,
 					Id:     fmt.Sprintf("%d", i),
 					Author: Author{
+						Id:       "gamers",
 						Username: "Gamers",
 						IsAdmin:  true,
 						IsBot:    false,
@@ -52,6 +62,7 @@ func NewEmitter() *TestEmitter {
 					},
 					Attachments: []Attachment{},
 				},
+				ExtraFields: TestInfo{},
 			}
 
 			go func() {
@@ -64,6 +75,7 @@ func NewEmitter() *TestEmitter {
 						Source: TestSource,
 						Id:     fmt.Sprintf("%d", a),
 						Author: Author{
+							Id:       "gamers",
 							Username: "Gamers",
 							IsAdmin:  true,
 							IsBot:    false,
@@ -72,6 +84,7 @@ func NewEmitter() *TestEmitter {
 						MessageParts: []MessagePart{},
 						Attachments:  []Attachment{},
 					},
+					ExtraFields: TestInfo{},
 				}
 			}()
 
@@ -0,0 +1,51 @@
+package test_source
+
+import (
+	"aya-backend/server-ws/chat_service"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	TestSource chat_service.Source = "test_source"
+)
+
+// TestInfo is the resource info of the test source. Every session subscribing
+// to the test source receives the same generated messages.
+type TestInfo struct{}
+
+type testPlugin struct{}
+
+func init() {
+	chat_service.RegisterSource(testPlugin{})
+}
+
+func (testPlugin) Source() chat_service.Source {
+	return TestSource
+}
+
+func (testPlugin) DecodeResourceInfo(data []byte) (any, error) {
+	var testInfo TestInfo
+	if err := json.Unmarshal(data, &testInfo); err != nil {
+		return nil, err
+	}
+	return testInfo, nil
+}
+
+func (testPlugin) ValidateResourceInfo(resourceInfo any) error {
+	if _, ok := resourceInfo.(TestInfo); !ok {
+		return fmt.Errorf("resource info is not a test resource")
+	}
+	return nil
+}
+
+func (testPlugin) ResourceKey(resourceInfo any) (string, error) {
+	if _, ok := resourceInfo.(TestInfo); !ok {
+		return "", fmt.Errorf("resource info is not a test resource")
+	}
+	return string(TestSource), nil
+}
+
+func (testPlugin) NewEmitter(config chat_service.EmitterConfig) (chat_service.SourceEmitter, error) {
+	return NewEmitter(), nil
+}
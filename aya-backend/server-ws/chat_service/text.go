@@ -0,0 +1,20 @@
+package chat_service
+
+import "strings"
+
+const (
+	ELLIPSIS = "…"
+)
+
+// TruncateText shortens the text to at most maxLength runes, ending it with an
+// ellipsis when it is cut.
+func TruncateText(text string, maxLength int) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= maxLength {
+		return string(runes)
+	}
+	if maxLength <= 0 {
+		return ""
+	}
+	return strings.TrimSpace(string(runes[:maxLength-1])) + ELLIPSIS
+}
@@ -34,8 +34,11 @@ type TwitchEmitter struct {
 	stopSignalCh chan bool
 
 	resource2Subscriber map[string]map[string]bool
+	tracker             *chat_service.AuthorMessageTracker
 
 	twitchClient *twitch.Client
+	// authenticated is false while the client is anonymous, which can only read the chats
+	authenticated bool
 }
 
 func (emitter *TwitchEmitter) Register(subscriber string, resourceInfo any) {
@@ -71,6 +74,7 @@ func (emitter *TwitchEmitter) Deregister(subscriber string, resourceInfo any) {
 	delete(emitter.resource2Subscriber[channelName], subscriber)
 	if len(emitter.resource2Subscriber[channelName]) == 0 {
 		delete(emitter.resource2Subscriber, channelName)
+		emitter.tracker.RemoveResource(channelName)
 		emitter.twitchClient.Depart(channelName)
 	}
 }
@@ -91,13 +95,69 @@ func (emitter *TwitchEmitter) ErrorEmitter() chan error {
 	return emitter.errorEmitter
 }
 
-func TwitchPrivateMessageHandler(parser *TwitchMessageParser, msgChan chan chat_service.MessageUpdate) func(message twitch.PrivateMessage) {
+func (emitter *TwitchEmitter) SendMessage(resourceInfo any, text string) error {
+	twitchInfo, ok := resourceInfo.(TwitchInfo)
+	if !ok {
+		return fmt.Errorf("resource info is not a twitch resource")
+	}
+	emitter.mutex.Lock()
+	defer emitter.mutex.Unlock()
+	if !emitter.authenticated {
+		return fmt.Errorf("twitch bot is not authenticated yet")
+	}
+	emitter.twitchClient.Say(twitchInfo.TwitchChannelName, text)
+	return nil
+}
+
+func TwitchPrivateMessageHandler(
+	parser *TwitchMessageParser,
+	tracker *chat_service.AuthorMessageTracker,
+	msgChan chan chat_service.MessageUpdate,
+) func(message twitch.PrivateMessage) {
 	return func(twitchMsg twitch.PrivateMessage) {
+		tracker.Track(twitchMsg.Channel, twitchMsg.User.ID, twitchMsg.ID)
 		msgChan <- parser.ParseMessage(twitchMsg)
 	}
 }
 
-func (emitter *TwitchEmitter) setClient(newClient *twitch.Client) {
+// TwitchClearMessageHandler handles a single message deleted by a moderator
+func TwitchClearMessageHandler(
+	parser *TwitchMessageParser,
+	tracker *chat_service.AuthorMessageTracker,
+	msgChan chan chat_service.MessageUpdate,
+) func(message twitch.ClearMessage) {
+	return func(clearMsg twitch.ClearMessage) {
+		tracker.RemoveMessage(clearMsg.Channel, clearMsg.TargetMsgID)
+		msgChan <- parser.ParseDelete(clearMsg.Channel, clearMsg.TargetMsgID, time.Now())
+	}
+}
+
+// TwitchClearChatHandler handles the ban or timeout of a user, or the clear of the whole chat
+func TwitchClearChatHandler(
+	parser *TwitchMessageParser,
+	tracker *chat_service.AuthorMessageTracker,
+	msgChan chan chat_service.MessageUpdate,
+) func(message twitch.ClearChatMessage) {
+	return func(clearChat twitch.ClearChatMessage) {
+		if clearChat.TargetUserID == "" {
+			tracker.RemoveResource(clearChat.Channel)
+			msgChan <- parser.ParseClearChat(clearChat)
+			return
+		}
+		for _, messageId := range tracker.RemoveAuthor(clearChat.Channel, clearChat.TargetUserID) {
+			msgChan <- parser.ParseDelete(clearChat.Channel, messageId, clearChat.Time)
+		}
+	}
+}
+
+// TwitchUserNoticeHandler handles the chat events, e.g. subs, resubs, raids and gift subs
+func TwitchUserNoticeHandler(parser *TwitchMessageParser, msgChan chan chat_service.MessageUpdate) func(message twitch.UserNoticeMessage) {
+	return func(userNotice twitch.UserNoticeMessage) {
+		msgChan <- parser.ParseUserNotice(userNotice)
+	}
+}
+
+func (emitter *TwitchEmitter) setClient(newClient *twitch.Client, authenticated bool) {
 	emitter.mutex.Lock()
 	defer emitter.mutex.Unlock()
 	if emitter.twitchClient != nil {
@@ -109,13 +169,17 @@ func (emitter *TwitchEmitter) setClient(newClient *twitch.Client) {
 	}
 
 	parser := TwitchMessageParser{}
-	newClient.OnPrivateMessage(TwitchPrivateMessageHandler(&parser, emitter.updateEmitter))
+	newClient.OnPrivateMessage(TwitchPrivateMessageHandler(&parser, emitter.tracker, emitter.updateEmitter))
+	newClient.OnClearMessage(TwitchClearMessageHandler(&parser, emitter.tracker, emitter.updateEmitter))
+	newClient.OnClearChatMessage(TwitchClearChatHandler(&parser, emitter.tracker, emitter.updateEmitter))
+	newClient.OnUserNoticeMessage(TwitchUserNoticeHandler(&parser, emitter.updateEmitter))
 
 	for resource := range emitter.resource2Subscriber {
 		newClient.Join(resource)
 	}
 
 	emitter.twitchClient = newClient
+	emitter.authenticated = authenticated
 	go func() {
 		err := newClient.Connect()
 		if err != nil {
@@ -130,9 +194,10 @@ func NewEmitter(config TwitchEmitterConfig) (*TwitchEmitter, error) {
 		updateEmitter:       make(chan chat_service.MessageUpdate),
 		errorEmitter:        make(chan error),
 		resource2Subscriber: make(map[string]map[string]bool),
+		tracker:             chat_service.NewAuthorMessageTracker(chat_service.TRACKED_AUTHORS_PER_RESOURCE, chat_service.TRACKED_MESSAGES_PER_AUTHOR),
 	}
 
-	emitter.setClient(twitch.NewAnonymousClient())
+	emitter.setClient(twitch.NewAnonymousClient(), false)
 	go func() {
 		workflow := auth.NewWorkflow()
 
@@ -167,7 +232,7 @@ func NewEmitter(config TwitchEmitterConfig) (*TwitchEmitter, error) {
 			}
 			// TODO: get the claim from the access OAUTH token from oidc code flow?
 			client := twitch.NewClient(config.BotUserName, fmt.Sprintf("oauth2:%s", token.AccessToken))
-			emitter.setClient(client)
+			emitter.setClient(client, true)
 			expirationTime := token.Expiry
 			refreshDuration := time.Until(expirationTime)
 			select {
@@ -2,31 +2,266 @@ package twitch_source
 
 import (
 	"aya-backend/server-ws/chat_service"
+	"fmt"
 	"github.com/gempir/go-twitch-irc/v4"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EMOTE_URL_FORMAT = "https://static-cdn.jtvnw.net/emoticons/v2/%s/default/dark/1.0"
+	BADGE_URL_FORMAT = "https://static-cdn.jtvnw.net/badges/v1/%s/1"
+	// twitch does not send the avatars over IRC, only the profile url is set
+	PROFILE_URL_FORMAT = "https://www.twitch.tv/%s"
+
+	BROADCASTER_BADGE = "broadcaster"
+	MODERATOR_BADGE   = "moderator"
+	VIP_BADGE         = "vip"
+	SUBSCRIBER_BADGE  = "subscriber"
+
+	DEFAULT_COLOR = "#ffffff"
+
+	SUB_PLAN_PARAM        = "msg-param-sub-plan"
+	CUMULATIVE_MONTHS     = "msg-param-cumulative-months"
+	GIFT_MONTHS_PARAM     = "msg-param-gift-months"
+	RECIPIENT_NAME_PARAM  = "msg-param-recipient-display-name"
+	MASS_GIFT_COUNT_PARAM = "msg-param-mass-gift-count"
+	RAID_VIEWERS_PARAM    = "msg-param-viewerCount"
+)
+
+var (
+	// image ids of the global badges. Badges of channel subscriptions are set up by
+	// each channel, so the default subscriber badge is used instead.
+	badgeImageIds = map[string]string{
+		BROADCASTER_BADGE: "5527c58c-fb7d-422d-b71b-f309dcb85cc1",
+		MODERATOR_BADGE:   "3267646d-33f0-4b17-b3df-f923a41db1d0",
+		VIP_BADGE:         "b817aba4-fad8-49e2-b88a-7cc744dfa6ec",
+		SUBSCRIBER_BADGE:  "5d9f2208-5dd8-11e7-8513-2ff4adfae661",
+	}
+
+	// badges are sorted in this order, the other badges come after them by name
+	badgeOrder = []string{BROADCASTER_BADGE, MODERATOR_BADGE, VIP_BADGE, SUBSCRIBER_BADGE}
+
+	subPlanToTier = map[string]string{
+		"Prime": "prime",
+		"1000":  "1",
+		"2000":  "2",
+		"3000":  "3",
+	}
+
+	knownBots = map[string]bool{
+		"nightbot":       true,
+		"streamelements": true,
+		"streamlabs":     true,
+		"moobot":         true,
+		"fossabot":       true,
+		"wizebot":        true,
+		"sery_bot":       true,
+		"soundalerts":    true,
+		"kofistreambot":  true,
+	}
 )
 
 type TwitchMessageParser struct {
 }
 
+type emoteOccurrence struct {
+	emote *twitch.Emote
+	start int
+	end   int
+}
+
+// ParseMessageParts splits the message into text and emote parts.
+// The emote positions given by twitch are inclusive indices over the runes of the message.
+func (parser *TwitchMessageParser) ParseMessageParts(message string, emotes []*twitch.Emote) []chat_service.MessagePart {
+	runes := []rune(message)
+
+	var occurrences []emoteOccurrence
+	for _, emote := range emotes {
+		for _, position := range emote.Positions {
+			if position.Start < 0 || position.End < position.Start || position.End >= len(runes) {
+				continue
+			}
+			occurrences = append(occurrences, emoteOccurrence{
+				emote: emote,
+				start: position.Start,
+				end:   position.End,
+			})
+		}
+	}
+	slices.SortFunc(occurrences, func(a, b emoteOccurrence) int {
+		return a.start - b.start
+	})
+
+	// an empty list rather than nil, so that the parts are never sent as null
+	messageParts := []chat_service.MessagePart{}
+	idx := 0
+	for _, occurrence := range occurrences {
+		if occurrence.start < idx {
+			// overlapping emote positions, ignore the latter one
+			continue
+		}
+		if occurrence.start > idx {
+			messageParts = append(messageParts, chat_service.MessagePart{
+				Content: string(runes[idx:occurrence.start]),
+			})
+		}
+		messageParts = append(messageParts, chat_service.MessagePart{
+			Emoji: &chat_service.Emoji{
+				Id:  fmt.Sprintf(EMOTE_URL_FORMAT, occurrence.emote.ID),
+				Alt: occurrence.emote.Name,
+			},
+		})
+		idx = occurrence.end + 1
+	}
+	if idx < len(runes) {
+		messageParts = append(messageParts, chat_service.MessagePart{
+			Content: string(runes[idx:]),
+		})
+	}
+	return messageParts
+}
+
+func badgeRank(name string) int {
+	rank := slices.Index(badgeOrder, name)
+	if rank == -1 {
+		return len(badgeOrder)
+	}
+	return rank
+}
+
+func (parser *TwitchMessageParser) ParseBadges(badges map[string]int) []chat_service.Badge {
+	var authorBadges []chat_service.Badge
+	for name, version := range badges {
+		badge := chat_service.Badge{
+			Name:    name,
+			Version: strconv.Itoa(version),
+		}
+		if imageId, ok := badgeImageIds[name]; ok {
+			badge.ImageUrl = fmt.Sprintf(BADGE_URL_FORMAT, imageId)
+		}
+		authorBadges = append(authorBadges, badge)
+	}
+	slices.SortFunc(authorBadges, func(a, b chat_service.Badge) int {
+		if rankDiff := badgeRank(a.Name) - badgeRank(b.Name); rankDiff != 0 {
+			return rankDiff
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return authorBadges
+}
+
+func (parser *TwitchMessageParser) ParseAuthor(user twitch.User) chat_service.Author {
+	_, isBroadcaster := user.Badges[BROADCASTER_BADGE]
+	_, isModerator := user.Badges[MODERATOR_BADGE]
+
+	color := user.Color
+	if color == "" {
+		color = DEFAULT_COLOR
+	}
+
+	return chat_service.Author{
+		Id:          user.ID,
+		Username:    user.Name,
+		DisplayName: user.DisplayName,
+		ProfileUrl:  fmt.Sprintf(PROFILE_URL_FORMAT, user.Name),
+		IsAdmin:     isBroadcaster || isModerator,
+		IsBot:       knownBots[strings.ToLower(user.Name)],
+		Color:       color,
+		Badges:      parser.ParseBadges(user.Badges),
+	}
+}
+
 func (parser *TwitchMessageParser) ParseMessage(twitchMsg twitch.PrivateMessage) chat_service.MessageUpdate {
 
 	return chat_service.MessageUpdate{
 		UpdateTime: twitchMsg.Time,
 		Update:     chat_service.New,
 		Message: chat_service.Message{
-			Source: chat_service.Twitch,
-			Id:     twitchMsg.ID,
-			Author: chat_service.Author{
-				Username: twitchMsg.User.Name,
-			},
-			MessageParts: []chat_service.MessagePart{
-				{
-					Content: twitchMsg.Message,
-				},
-			},
+			Source:       TwitchSource,
+			Id:           twitchMsg.ID,
+			Author:       parser.ParseAuthor(twitchMsg.User),
+			MessageParts: parser.ParseMessageParts(twitchMsg.Message, twitchMsg.Emotes),
 		},
 		ExtraFields: TwitchInfo{
 			TwitchChannelName: twitchMsg.Channel,
 		},
 	}
 }
+
+func getIntParam(params map[string]string, key string) int {
+	value, err := strconv.Atoi(params[key])
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+func (parser *TwitchMessageParser) ParseEvent(userNotice twitch.UserNoticeMessage) *chat_service.MessageEvent {
+	params := userNotice.MsgParams
+	event := chat_service.MessageEvent{
+		Type:          userNotice.MsgID,
+		SystemMessage: userNotice.SystemMsg,
+		Tier:          subPlanToTier[params[SUB_PLAN_PARAM]],
+		Recipient:     params[RECIPIENT_NAME_PARAM],
+	}
+	switch userNotice.MsgID {
+	case "sub", "resub":
+		event.Months = getIntParam(params, CUMULATIVE_MONTHS)
+	case "subgift":
+		event.Months = getIntParam(params, GIFT_MONTHS_PARAM)
+		event.Count = 1
+	case "submysterygift":
+		event.Count = getIntParam(params, MASS_GIFT_COUNT_PARAM)
+	case "raid":
+		event.Count = getIntParam(params, RAID_VIEWERS_PARAM)
+	default:
+	}
+	return &event
+}
+
+func (parser *TwitchMessageParser) ParseUserNotice(userNotice twitch.UserNoticeMessage) chat_service.MessageUpdate {
+	return chat_service.MessageUpdate{
+		UpdateTime: userNotice.Time,
+		Update:     chat_service.New,
+		Message: chat_service.Message{
+			Source:       TwitchSource,
+			Id:           userNotice.ID,
+			Author:       parser.ParseAuthor(userNotice.User),
+			MessageParts: parser.ParseMessageParts(userNotice.Message, userNotice.Emotes),
+			Event:        parser.ParseEvent(userNotice),
+		},
+		ExtraFields: TwitchInfo{
+			TwitchChannelName: userNotice.Channel,
+		},
+	}
+}
+
+func (parser *TwitchMessageParser) ParseDelete(channelName string, messageId string, updateTime time.Time) chat_service.MessageUpdate {
+	return chat_service.MessageUpdate{
+		UpdateTime: updateTime,
+		Update:     chat_service.Delete,
+		Message: chat_service.Message{
+			Source: TwitchSource,
+			Id:     messageId,
+		},
+		ExtraFields: TwitchInfo{
+			TwitchChannelName: channelName,
+		},
+	}
+}
+
+func (parser *TwitchMessageParser) ParseClearChat(clearChat twitch.ClearChatMessage) chat_service.MessageUpdate {
+	return chat_service.MessageUpdate{
+		UpdateTime: clearChat.Time,
+		Update:     chat_service.Clear,
+		Message: chat_service.Message{
+			Source: TwitchSource,
+		},
+		ExtraFields: TwitchInfo{
+			TwitchChannelName: clearChat.Channel,
+		},
+	}
+}
@@ -0,0 +1,69 @@
+package twitch_source
+
+import (
+	"aya-backend/server-ws/chat_service"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	TwitchSource chat_service.Source = "twitch"
+
+	TWITCH_CLIENT_ID_ENV     = "TWITCH_CLIENT_ID"
+	TWITCH_CLIENT_SECRET_ENV = "TWITCH_CLIENT_SECRET"
+	TWITCH_BOT_USERNAME_ENV  = "TWITCH_BOT_USERNAME"
+)
+
+type twitchPlugin struct{}
+
+func init() {
+	chat_service.RegisterSource(twitchPlugin{})
+}
+
+func (twitchPlugin) Source() chat_service.Source {
+	return TwitchSource
+}
+
+func (twitchPlugin) DecodeResourceInfo(data []byte) (any, error) {
+	var twitchInfo TwitchInfo
+	if err := json.Unmarshal(data, &twitchInfo); err != nil {
+		return nil, err
+	}
+	return twitchInfo, nil
+}
+
+func (twitchPlugin) ValidateResourceInfo(resourceInfo any) error {
+	twitchInfo, ok := resourceInfo.(TwitchInfo)
+	if !ok {
+		return fmt.Errorf("resource info is not a twitch resource")
+	}
+	if twitchInfo.TwitchChannelName == "" {
+		return fmt.Errorf("twitch channel name is required")
+	}
+	return nil
+}
+
+func (twitchPlugin) ResourceKey(resourceInfo any) (string, error) {
+	twitchInfo, ok := resourceInfo.(TwitchInfo)
+	if !ok {
+		return "", fmt.Errorf("resource info is not a twitch resource")
+	}
+	return twitchInfo.TwitchChannelName, nil
+}
+
+func (twitchPlugin) NewEmitter(config chat_service.EmitterConfig) (chat_service.SourceEmitter, error) {
+	twitchEmitterConfig := TwitchEmitterConfig{
+		ClientID:             os.Getenv(TWITCH_CLIENT_ID_ENV),
+		ClientSecret:         os.Getenv(TWITCH_CLIENT_SECRET_ENV),
+		BotUserName:          os.Getenv(TWITCH_BOT_USERNAME_ENV),
+		AuthRouter:           config.AuthRouter,
+		AuthRedirectBasedUrl: config.AuthRedirectBasedUrl,
+	}
+
+	twitchEmitter, err := NewEmitter(twitchEmitterConfig)
+	if err != nil {
+		return nil, err
+	}
+	return twitchEmitter, nil
+}
@@ -88,6 +88,14 @@ func (emitter *YoutubeEmitter) ErrorEmitter() chan error {
 	return emitter.errorEmitter
 }
 
+func (emitter *YoutubeEmitter) SendMessage(resourceInfo any, text string) error {
+	ytInfo, ok := resourceInfo.(YoutubeInfo)
+	if !ok {
+		return fmt.Errorf("resource info is not a youtube resource")
+	}
+	return emitter.register.sendMessage(ytInfo.YoutubeChannelId, text)
+}
+
 func getApiKeyYTService(ctx context.Context, config *YoutubeEmitterConfig) (*yt.Service, error) {
 	ytService, err := yt.NewService(ctx, option.WithAPIKey(config.ApiKey))
 	if err != nil {
@@ -2,30 +2,165 @@ package youtube_source
 
 import (
 	. "aya-backend/server-ws/chat_service"
+	"fmt"
 	yt "google.golang.org/api/youtube/v3"
+	"strconv"
+)
+
+const (
+	TEXT_MESSAGE_EVENT             = "textMessageEvent"
+	SUPER_CHAT_EVENT               = "superChatEvent"
+	SUPER_STICKER_EVENT            = "superStickerEvent"
+	NEW_SPONSOR_EVENT              = "newSponsorEvent"
+	MEMBER_MILESTONE_CHAT_EVENT    = "memberMilestoneChatEvent"
+	MEMBERSHIP_GIFTING_EVENT       = "membershipGiftingEvent"
+	GIFT_MEMBERSHIP_RECEIVED_EVENT = "giftMembershipReceivedEvent"
+
+	MEMBERSHIP_COLOR = "#0f9d58"
+
+	CHANNEL_URL_FORMAT = "https://www.youtube.com/channel/%s"
+)
+
+var (
+	// colors YouTube uses for the Super Chats and Super Stickers of each tier
+	superChatTierColors = map[int64]string{
+		1: "#1e88e5",
+		2: "#00e5ff",
+		3: "#1de9b6",
+		4: "#ffca28",
+		5: "#f57c00",
+		6: "#e91e63",
+		7: "#e62117",
+	}
 )
 
 type YoutubeMessageParser struct {
 }
 
+func (parser *YoutubeMessageParser) ParseBadges(authorDetails *yt.LiveChatMessageAuthorDetails) []Badge {
+	var badges []Badge
+	if authorDetails.IsChatOwner {
+		badges = append(badges, Badge{Name: "owner"})
+	}
+	if authorDetails.IsChatModerator {
+		badges = append(badges, Badge{Name: "moderator"})
+	}
+	if authorDetails.IsChatSponsor {
+		badges = append(badges, Badge{Name: "member"})
+	}
+	if authorDetails.IsVerified {
+		badges = append(badges, Badge{Name: "verified"})
+	}
+	return badges
+}
+
 func (parser *YoutubeMessageParser) ParseAuthor(authorDetails *yt.LiveChatMessageAuthorDetails) Author {
+	profileUrl := authorDetails.ChannelUrl
+	if profileUrl == "" && authorDetails.ChannelId != "" {
+		profileUrl = fmt.Sprintf(CHANNEL_URL_FORMAT, authorDetails.ChannelId)
+	}
 	return Author{
-		Username: authorDetails.DisplayName,
-		IsAdmin:  authorDetails.IsChatModerator,
-		IsBot:    false,
-		Color:    "#ffffff",
+		Id:          authorDetails.ChannelId,
+		Username:    authorDetails.DisplayName,
+		DisplayName: authorDetails.DisplayName,
+		AvatarUrl:   authorDetails.ProfileImageUrl,
+		ProfileUrl:  profileUrl,
+		IsAdmin:     authorDetails.IsChatModerator || authorDetails.IsChatOwner,
+		IsBot:       false,
+		Color:       "#ffffff",
+		Badges:      parser.ParseBadges(authorDetails),
+	}
+}
+
+func getTextParts(text string) []MessagePart {
+	if text == "" {
+		return []MessagePart{}
+	}
+	return []MessagePart{
+		{
+			Content: text,
+		},
+	}
+}
+
+// ParseEvent returns the event of the paid and membership messages, and the text
+// the author wrote with it. It returns a nil event for the plain text messages.
+func (parser *YoutubeMessageParser) ParseEvent(snippet *yt.LiveChatMessageSnippet) (*MessageEvent, string) {
+	event := MessageEvent{
+		Type:          snippet.Type,
+		SystemMessage: snippet.DisplayMessage,
+	}
+	switch snippet.Type {
+	case SUPER_CHAT_EVENT:
+		details := snippet.SuperChatDetails
+		if details == nil {
+			return nil, snippet.DisplayMessage
+		}
+		event.SystemMessage = ""
+		event.Amount = details.AmountDisplayString
+		event.AmountMicros = details.AmountMicros
+		event.Currency = details.Currency
+		event.Tier = strconv.FormatInt(details.Tier, 10)
+		event.HighlightColor = superChatTierColors[details.Tier]
+		return &event, details.UserComment
+	case SUPER_STICKER_EVENT:
+		details := snippet.SuperStickerDetails
+		if details == nil {
+			return nil, snippet.DisplayMessage
+		}
+		event.SystemMessage = ""
+		event.Amount = details.AmountDisplayString
+		event.AmountMicros = details.AmountMicros
+		event.Currency = details.Currency
+		event.Tier = strconv.FormatInt(details.Tier, 10)
+		event.HighlightColor = superChatTierColors[details.Tier]
+		if details.SuperStickerMetadata == nil {
+			return &event, ""
+		}
+		event.StickerId = details.SuperStickerMetadata.StickerId
+		event.StickerAlt = details.SuperStickerMetadata.AltText
+		// the api has no url for the image of the sticker, so its alt text is shown as the message
+		return &event, details.SuperStickerMetadata.AltText
+	case NEW_SPONSOR_EVENT:
+		if details := snippet.NewSponsorDetails; details != nil {
+			event.Tier = details.MemberLevelName
+		}
+		event.HighlightColor = MEMBERSHIP_COLOR
+		return &event, ""
+	case MEMBER_MILESTONE_CHAT_EVENT:
+		details := snippet.MemberMilestoneChatDetails
+		if details == nil {
+			return nil, snippet.DisplayMessage
+		}
+		event.Tier = details.MemberLevelName
+		event.Months = int(details.MemberMonth)
+		event.HighlightColor = MEMBERSHIP_COLOR
+		return &event, details.UserComment
+	case MEMBERSHIP_GIFTING_EVENT:
+		if details := snippet.MembershipGiftingDetails; details != nil {
+			event.Tier = details.GiftMembershipsLevelName
+			event.Count = int(details.GiftMembershipsCount)
+		}
+		event.HighlightColor = MEMBERSHIP_COLOR
+		return &event, ""
+	case GIFT_MEMBERSHIP_RECEIVED_EVENT:
+		if details := snippet.GiftMembershipReceivedDetails; details != nil {
+			event.Tier = details.MemberLevelName
+		}
+		event.HighlightColor = MEMBERSHIP_COLOR
+		return &event, ""
+	default:
+		return nil, snippet.DisplayMessage
 	}
 }
 
 func (parser *YoutubeMessageParser) ParseMessage(msg *yt.LiveChatMessage) Message {
+	event, text := parser.ParseEvent(msg.Snippet)
 	return Message{
-		Source: Youtube,
-		Id:     msg.Id,
-		Author: parser.ParseAuthor(msg.AuthorDetails),
-		MessageParts: []MessagePart{
-			{
-				Content: msg.Snippet.DisplayMessage,
-			},
-		},
+		Source:       YoutubeSource,
+		Id:           msg.Id,
+		Author:       parser.ParseAuthor(msg.AuthorDetails),
+		MessageParts: getTextParts(text),
+		Event:        event,
 	}
 }
@@ -0,0 +1,69 @@
+package youtube_source
+
+import (
+	"aya-backend/server-ws/chat_service"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	YoutubeSource chat_service.Source = "youtube"
+
+	YOUTUBE_API_KEY_ENV       = "YOUTUBE_API_KEY"
+	YOUTUBE_CLIENT_ID_ENV     = "YOUTUBE_CLIENT_ID"
+	YOUTUBE_CLIENT_SECRET_ENV = "YOUTUBE_CLIENT_SECRET"
+)
+
+type youtubePlugin struct{}
+
+func init() {
+	chat_service.RegisterSource(youtubePlugin{})
+}
+
+func (youtubePlugin) Source() chat_service.Source {
+	return YoutubeSource
+}
+
+func (youtubePlugin) DecodeResourceInfo(data []byte) (any, error) {
+	var youtubeInfo YoutubeInfo
+	if err := json.Unmarshal(data, &youtubeInfo); err != nil {
+		return nil, err
+	}
+	return youtubeInfo, nil
+}
+
+func (youtubePlugin) ValidateResourceInfo(resourceInfo any) error {
+	youtubeInfo, ok := resourceInfo.(YoutubeInfo)
+	if !ok {
+		return fmt.Errorf("resource info is not a youtube resource")
+	}
+	if youtubeInfo.YoutubeChannelId == "" {
+		return fmt.Errorf("youtube channel id is required")
+	}
+	return nil
+}
+
+func (youtubePlugin) ResourceKey(resourceInfo any) (string, error) {
+	youtubeInfo, ok := resourceInfo.(YoutubeInfo)
+	if !ok {
+		return "", fmt.Errorf("resource info is not a youtube resource")
+	}
+	return youtubeInfo.YoutubeChannelId, nil
+}
+
+func (youtubePlugin) NewEmitter(config chat_service.EmitterConfig) (chat_service.SourceEmitter, error) {
+	ytEmitterConfig := &YoutubeEmitterConfig{
+		ApiKey:               os.Getenv(YOUTUBE_API_KEY_ENV),
+		ClientID:             os.Getenv(YOUTUBE_CLIENT_ID_ENV),
+		ClientSecret:         os.Getenv(YOUTUBE_CLIENT_SECRET_ENV),
+		AuthRouter:           config.AuthRouter,
+		AuthRedirectBasedUrl: config.AuthRedirectBasedUrl,
+	}
+
+	youtubeEmitter, err := NewEmitter(ytEmitterConfig)
+	if err != nil {
+		return nil, err
+	}
+	return youtubeEmitter, nil
+}
@@ -12,22 +12,32 @@ import (
 
 const (
 	TIME_UNTIL_RETRY = 30 * time.Second
+
+	MESSAGE_DELETED_EVENT = "messageDeletedEvent"
+	USER_BANNED_EVENT     = "userBannedEvent"
 )
 
 type youtubeRegister struct {
 	mutex             sync.Mutex
 	channelKillSignal map[string]chan bool
-	apiCaller         *liveChatApiCaller
-	ytService         *yt.Service
-	msgChan           chan chat_service.MessageUpdate
+	// channelLiveChat is the live chat currently read for each channel
+	channelLiveChat map[string]string
+	apiCaller       *liveChatApiCaller
+	ytService       *yt.Service
+	// authenticated is false until the OAuth service replaces the api key one
+	authenticated bool
+	msgChan       chan chat_service.MessageUpdate
+	tracker       *chat_service.AuthorMessageTracker
 }
 
 func newYoutubeRegister(ytService *yt.Service, msgChan chan chat_service.MessageUpdate) *youtubeRegister {
 	youtubeReg := youtubeRegister{
 		channelKillSignal: make(map[string]chan bool),
+		channelLiveChat:   make(map[string]string),
 		apiCaller:         newApiCaller(ytService),
 		ytService:         ytService,
 		msgChan:           msgChan,
+		tracker:           chat_service.NewAuthorMessageTracker(chat_service.TRACKED_AUTHORS_PER_RESOURCE, chat_service.TRACKED_MESSAGES_PER_AUTHOR),
 	}
 	return &youtubeReg
 }
@@ -73,6 +83,69 @@ func getLiveChatIdFromChannelId(ytService *yt.Service, channelId string) (string
 	return liveChatId, nil
 }
 
+func newDeleteUpdate(channelId string, messageId string, updateTime time.Time) chat_service.MessageUpdate {
+	return chat_service.MessageUpdate{
+		UpdateTime: updateTime,
+		Update:     chat_service.Delete,
+		Message: chat_service.Message{
+			Source: YoutubeSource,
+			Id:     messageId,
+		},
+		ExtraFields: YoutubeInfo{
+			YoutubeChannelId: channelId,
+		},
+	}
+}
+
+// parseChatItem turns a live chat item into the updates to send. Deleted messages and
+// banned users are turned into deletes, the other items into new messages.
+func parseChatItem(
+	item *yt.LiveChatMessage,
+	channelId string,
+	parser *YoutubeMessageParser,
+	tracker *chat_service.AuthorMessageTracker,
+) []chat_service.MessageUpdate {
+	publishedTime, parseErr := time.Parse(time.RFC3339, item.Snippet.PublishedAt)
+	if parseErr != nil {
+		publishedTime = time.Now()
+	}
+
+	switch item.Snippet.Type {
+	case MESSAGE_DELETED_EVENT:
+		if item.Snippet.MessageDeletedDetails == nil {
+			return []chat_service.MessageUpdate{}
+		}
+		tracker.RemoveMessage(channelId, item.Snippet.MessageDeletedDetails.DeletedMessageId)
+		return []chat_service.MessageUpdate{
+			newDeleteUpdate(channelId, item.Snippet.MessageDeletedDetails.DeletedMessageId, publishedTime),
+		}
+	case USER_BANNED_EVENT:
+		bannedDetails := item.Snippet.UserBannedDetails
+		if bannedDetails == nil || bannedDetails.BannedUserDetails == nil {
+			return []chat_service.MessageUpdate{}
+		}
+		var updates []chat_service.MessageUpdate
+		for _, messageId := range tracker.RemoveAuthor(channelId, bannedDetails.BannedUserDetails.ChannelId) {
+			updates = append(updates, newDeleteUpdate(channelId, messageId, publishedTime))
+		}
+		return updates
+	default:
+		if item.AuthorDetails != nil {
+			tracker.Track(channelId, item.AuthorDetails.ChannelId, item.Id)
+		}
+		return []chat_service.MessageUpdate{
+			{
+				UpdateTime: publishedTime,
+				Update:     chat_service.New,
+				Message:    parser.ParseMessage(item),
+				ExtraFields: YoutubeInfo{
+					YoutubeChannelId: channelId,
+				},
+			},
+		}
+	}
+}
+
 func listenForChatMessages(
 	ytService *yt.Service,
 	apiCaller *liveChatApiCaller,
@@ -80,6 +153,7 @@ func listenForChatMessages(
 	channelId string,
 	stopSignal chan bool,
 	parser *YoutubeMessageParser,
+	tracker *chat_service.AuthorMessageTracker,
 ) chan chat_service.MessageUpdate {
 	var err error
 	msgChan := make(chan chat_service.MessageUpdate)
@@ -107,18 +181,9 @@ func listenForChatMessages(
 				color.Green("response received!")
 				for _, item := range response.Items {
 					if item != nil && item.Snippet != nil {
-						publishedTime, parseErr := time.Parse(time.RFC3339, item.Snippet.PublishedAt)
-						if parseErr != nil {
-							publishedTime = time.Now()
-						}
 						fmt.Printf("%#v\n", item)
-						msgChan <- chat_service.MessageUpdate{
-							UpdateTime: publishedTime,
-							Update:     chat_service.New,
-							Message:    parser.ParseMessage(item),
-							ExtraFields: YoutubeInfo{
-								YoutubeChannelId: channelId,
-							},
+						for _, msgUpdate := range parseChatItem(item, channelId, parser, tracker) {
+							msgChan <- msgUpdate
 						}
 					}
 				}
@@ -163,8 +228,11 @@ func (register *youtubeRegister) registerChannel(channelId string) {
 			errCh <- err
 			return nil
 		}
+		register.mutex.Lock()
+		register.channelLiveChat[channelId] = liveChatId
+		register.mutex.Unlock()
 
-		return listenForChatMessages(register.ytService, register.apiCaller, liveChatId, channelId, stopDuringListening, &ytParser)
+		return listenForChatMessages(register.ytService, register.apiCaller, liveChatId, channelId, stopDuringListening, &ytParser, register.tracker)
 	}
 
 	go func() {
@@ -212,7 +280,10 @@ func (register *youtubeRegister) registerChannel(channelId string) {
 }
 
 func (register *youtubeRegister) SetYTService(ytService *yt.Service) {
+	register.mutex.Lock()
 	register.ytService = ytService
+	register.authenticated = true
+	register.mutex.Unlock()
 	register.apiCaller.SetYTService(ytService)
 }
 
@@ -224,9 +295,11 @@ func (register *youtubeRegister) deregisterChannel(channelId string) {
 		fmt.Printf("channel %s have not been registered, doing nothing\n", channelId)
 		return
 	}
-	register.channelKillSignal[channelId] <- true
+	// closing the signal stops the listening goroutine without blocking while the mutex is held
 	close(register.channelKillSignal[channelId])
 	delete(register.channelKillSignal, channelId)
+	delete(register.channelLiveChat, channelId)
+	register.tracker.RemoveResource(channelId)
 	fmt.Printf("channel %s has been deregistered\n", channelId)
 }
 
@@ -234,11 +307,41 @@ func (register *youtubeRegister) Stop() {
 	register.mutex.Lock()
 	defer register.mutex.Unlock()
 	for channelId, killSig := range register.channelKillSignal {
-		killSig <- true
-		color.Red("Kill Signal sent to channel %s", channelId)
 		close(killSig)
+		color.Red("Kill Signal sent to channel %s", channelId)
 		delete(register.channelKillSignal, channelId)
+		delete(register.channelLiveChat, channelId)
 	}
 
 	register.apiCaller.Stop()
 }
+
+// sendMessage posts the text to the live chat of the channel, which must be registered
+func (register *youtubeRegister) sendMessage(channelId string, text string) error {
+	register.mutex.Lock()
+	ytService := register.ytService
+	authenticated := register.authenticated
+	liveChatId, ok := register.channelLiveChat[channelId]
+	register.mutex.Unlock()
+
+	if !authenticated {
+		return fmt.Errorf("youtube account is not authenticated yet")
+	}
+	if !ok {
+		return fmt.Errorf("no live chat is being read for channel %s", channelId)
+	}
+
+	liveChatMessage := yt.LiveChatMessage{
+		Snippet: &yt.LiveChatMessageSnippet{
+			LiveChatId: liveChatId,
+			Type:       TEXT_MESSAGE_EVENT,
+			TextMessageDetails: &yt.LiveChatTextMessageDetails{
+				MessageText: text,
+			},
+		},
+	}
+	_, err := yt.NewLiveChatMessagesService(ytService).
+		Insert([]string{"snippet"}, &liveChatMessage).
+		Do()
+	return err
+}
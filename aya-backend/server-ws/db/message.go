@@ -0,0 +1,102 @@
+package db
+
+import (
+	models "aya-backend/db-models"
+	"aya-backend/server-ws/chat_service"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	ARCHIVE_QUEUE_SIZE     = 1000
+	ARCHIVE_BATCH_SIZE     = 100
+	ARCHIVE_FLUSH_INTERVAL = 2 * time.Second
+)
+
+// MessageArchive writes every message sent to a session into the database.
+// Writes are batched in the background so that the dispatch loop is not blocked by the db.
+type MessageArchive struct {
+	db      *gorm.DB
+	queue   chan *models.GORMMessage
+	stopSig chan bool
+	stopped chan bool
+}
+
+func NewMessageArchive(db *gorm.DB) *MessageArchive {
+	archive := MessageArchive{
+		db:      db,
+		queue:   make(chan *models.GORMMessage, ARCHIVE_QUEUE_SIZE),
+		stopSig: make(chan bool),
+		stopped: make(chan bool),
+	}
+
+	go func() {
+		var batch []*models.GORMMessage
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			result := archive.db.CreateInBatches(batch, ARCHIVE_BATCH_SIZE)
+			if result.Error != nil {
+				fmt.Printf("Error during archiving %d messages: %s\n", len(batch), result.Error.Error())
+			}
+			batch = nil
+		}
+
+		ticker := time.NewTicker(ARCHIVE_FLUSH_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case msg := <-archive.queue:
+				batch = append(batch, msg)
+				if len(batch) >= ARCHIVE_BATCH_SIZE {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			case <-archive.stopSig:
+				for {
+					select {
+					case msg := <-archive.queue:
+						batch = append(batch, msg)
+					default:
+						flush()
+						close(archive.stopped)
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return &archive
+}
+
+// Archive queues the message to be stored for each of the given sessions
+func (archive *MessageArchive) Archive(sessionIds []string, msg chat_service.MessageUpdate) {
+	for _, sessionId := range sessionIds {
+		sessionUUID, err := uuid.Parse(sessionId)
+		if err != nil {
+			fmt.Printf("Cannot archive message for session \"%s\": %s\n", sessionId, err.Error())
+			continue
+		}
+		gormMessage, err := models.NewGORMMessage(sessionUUID, msg)
+		if err != nil {
+			fmt.Printf("Cannot archive message for session \"%s\": %s\n", sessionId, err.Error())
+			continue
+		}
+		select {
+		case archive.queue <- gormMessage:
+		default:
+			fmt.Printf("Archive queue is full, dropping message %s for session %s\n", msg.Message.Id, sessionId)
+		}
+	}
+}
+
+// Close flushes the remaining messages to the database
+func (archive *MessageArchive) Close() {
+	archive.stopSig <- true
+	<-archive.stopped
+}
@@ -41,10 +41,28 @@ func (infoDB *InfoDB) GetResourcesOfSession(sessionId string) []models.Resource
 	if err != nil {
 		return []models.Resource{}
 	}
+	logInvalidResources(sessionId, resources)
 	return resources
 }
 
-func (infoDB *InfoDB) GetResourcesInfo(registeredSessions map[string]bool, lastUpdated time.Time) map[string][]models.Resource {
+// logInvalidResources logs the stored resources that would not be accepted anymore.
+// They are kept, the sources skip those they cannot subscribe to.
+func logInvalidResources(sessionId string, resources []models.Resource) {
+	for _, resource := range resources {
+		if err := resource.Validate(); err != nil {
+			fmt.Printf("Invalid resource stored for session %s: %s\n", sessionId, err.Error())
+		}
+	}
+}
+
+// SessionInfo is what the message hub needs to know about a session
+type SessionInfo struct {
+	IsOn            bool
+	Resources       []models.Resource
+	ModerationRules models.ModerationRules
+}
+
+func (infoDB *InfoDB) GetSessionsInfo(registeredSessions map[string]bool, lastUpdated time.Time) map[string]SessionInfo {
 	var notPopSessions []string
 	var allSessions []string
 	for sessionId, isPopulated := range registeredSessions {
@@ -56,17 +74,17 @@ func (infoDB *InfoDB) GetResourcesInfo(registeredSessions map[string]bool, lastU
 	var sessions []models.GORMSession
 	result := infoDB.db.Where("uuid IN ?", notPopSessions).Or("uuid IN ? AND updated_at is not NULL AND updated_at >= ?", allSessions, lastUpdated).Find(&sessions)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		return map[string][]models.Resource{}
+		return map[string]SessionInfo{}
 	} else if result.Error != nil {
 		fmt.Printf("Unknown error: %s\n", result.Error.Error())
-		return map[string][]models.Resource{}
+		return map[string]SessionInfo{}
 	}
 
-	session2Resources := make(map[string][]models.Resource)
+	session2Info := make(map[string]SessionInfo)
 	for _, session := range sessions {
 		sessionUUID := session.UUID.String()
 		if !session.IsOn {
-			session2Resources[sessionUUID] = []models.Resource{}
+			session2Info[sessionUUID] = SessionInfo{Resources: []models.Resource{}}
 			continue
 		}
 		fmt.Printf("Session %s is on, start reading the resources\n", sessionUUID)
@@ -75,9 +93,59 @@ func (infoDB *InfoDB) GetResourcesInfo(registeredSessions map[string]bool, lastU
 		if err != nil {
 			resources = []models.Resource{}
 		}
-		session2Resources[sessionUUID] = resources
+		logInvalidResources(sessionUUID, resources)
+		moderationRules, err := models.ParseModerationRules(session.ModerationRules)
+		if err != nil {
+			fmt.Printf("Ignoring the moderation rules of session %s: %s\n", sessionUUID, err.Error())
+			moderationRules = models.ModerationRules{}
+		}
+		session2Info[sessionUUID] = SessionInfo{
+			IsOn:            true,
+			Resources:       resources,
+			ModerationRules: moderationRules,
+		}
+	}
+	return session2Info
+}
+
+// GetAllowedOrigins returns the origin patterns that can embed the stream of the session,
+// none if the session does not restrict them
+func (infoDB *InfoDB) GetAllowedOrigins(sessionId string) ([]string, error) {
+	sessionUUID, err := uuid.Parse(sessionId)
+	if err != nil {
+		return nil, nil
+	}
+	var session models.GORMSession
+	result := infoDB.db.
+		Where("uuid = ?", sessionUUID).
+		First(&session)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return models.ParseAllowedOrigins(session.AllowedOrigins)
+}
+
+// IsStreamTokenRevoked checks whether the viewer token was revoked. Tokens that
+// cannot be found, e.g. deleted with their session, are revoked too.
+func (infoDB *InfoDB) IsStreamTokenRevoked(tokenId string) (bool, error) {
+	tokenUUID, err := uuid.Parse(tokenId)
+	if err != nil {
+		return true, nil
+	}
+	var token models.GORMStreamToken
+	result := infoDB.db.
+		Where("uuid = ?", tokenUUID).
+		First(&token)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return true, nil
+	}
+	if result.Error != nil {
+		return false, result.Error
 	}
-	return session2Resources
+	return token.RevokedAt != nil, nil
 }
 
 func NewInfoDB(db *gorm.DB) *InfoDB {
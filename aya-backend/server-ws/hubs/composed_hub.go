@@ -4,10 +4,8 @@ import (
 	models "aya-backend/db-models"
 	"aya-backend/server-ws/chat_service"
 	"aya-backend/server-ws/chat_service/composed"
-	discordsource "aya-backend/server-ws/chat_service/discord"
-	twitchsource "aya-backend/server-ws/chat_service/twitch"
-	youtubesource "aya-backend/server-ws/chat_service/youtube"
 	"aya-backend/server-ws/db"
+	"aya-backend/server-ws/moderation"
 	"fmt"
 	"gorm.io/gorm"
 	"sync"
@@ -20,24 +18,35 @@ const (
 
 type MessageHub struct {
 	SessionResourceHub
-	mutex      sync.RWMutex
-	discordHub *DiscordResourceHub
-	youtubeHub *YoutubeResourceHub
-	twitchHub  *TwitchResourceHub
+	mutex        sync.RWMutex
+	resourceHubs map[chat_service.Source]*ResourceHub
 
 	infoDB *db.InfoDB
 
 	registeredSessions map[string]bool
+	sessionFilters     map[string]*moderation.Filter
+	// sessionOffListeners are called when a registered session is turned off
+	sessionOffListeners []func(sessionId string)
+	// sessionRemovedListeners are called when a session is removed from the hub
+	sessionRemovedListeners []func(sessionId string)
 }
 
 func NewMessageHub(emitter *composed.MessageEmitter, gormDB *gorm.DB) *MessageHub {
 
 	msgHub := MessageHub{
-		discordHub:         NewDiscordResourceHub(emitter.GetDiscordEmitter()),
-		youtubeHub:         NewYoutubeResourceHub(emitter.GetYoutubeEmitter()),
-		twitchHub:          NewTwitchResourceHub(emitter.GetTwitchEmitter()),
+		resourceHubs:       make(map[chat_service.Source]*ResourceHub),
 		infoDB:             db.NewInfoDB(gormDB),
 		registeredSessions: make(map[string]bool),
+		sessionFilters:     make(map[string]*moderation.Filter),
+	}
+
+	for _, source := range emitter.Sources() {
+		plugin, ok := chat_service.GetSourcePlugin(source)
+		if !ok {
+			continue
+		}
+		sourceEmitter, _ := emitter.GetEmitter(source)
+		msgHub.resourceHubs[source] = NewResourceHub(plugin, sourceEmitter)
 	}
 
 	go func() {
@@ -45,14 +54,18 @@ func NewMessageHub(emitter *composed.MessageEmitter, gormDB *gorm.DB) *MessageHu
 		for {
 			<-time.After(DATA_RETRIEVAL_INTERVAL)
 			newTime := time.Now()
-			resourceInfoMap := msgHub.infoDB.GetResourcesInfo(msgHub.registeredSessions, lastUpdateTime)
-			if len(resourceInfoMap) > 0 {
+			sessionInfoMap := msgHub.infoDB.GetSessionsInfo(msgHub.registeredSessions, lastUpdateTime)
+			if len(sessionInfoMap) > 0 {
 				fmt.Println("Changes detected:")
 			}
-			for sessionId, resources := range resourceInfoMap {
+			for sessionId, sessionInfo := range sessionInfoMap {
 				fmt.Printf("Update session with Id %s\n", sessionId)
-				fmt.Printf("New resources info: %s\n", resources)
-				msgHub.RegisterSessionResources(sessionId, resources)
+				fmt.Printf("New resources info: %s\n", sessionInfo.Resources)
+				msgHub.SetSessionModerationRules(sessionId, sessionInfo.ModerationRules)
+				msgHub.RegisterSessionResources(sessionId, sessionInfo.Resources)
+				if !sessionInfo.IsOn {
+					msgHub.notifySessionOff(sessionId)
+				}
 			}
 			lastUpdateTime = newTime
 		}
@@ -69,70 +82,34 @@ func (m *MessageHub) GetSessionId(resourceInfo any) []string {
 	if !ok {
 		return []string{}
 	}
-	switch hubResourceInfo.ResourceType {
-	case chat_service.Discord:
-		if m.discordHub != nil {
-			return m.discordHub.GetSessionId(hubResourceInfo.ResourceInfo)
-		} else {
-			return []string{}
-		}
-	case chat_service.Youtube:
-		if m.youtubeHub != nil {
-			return m.youtubeHub.GetSessionId(hubResourceInfo.ResourceInfo)
-		} else {
-			return []string{}
-		}
-	case chat_service.Twitch:
-		if m.twitchHub != nil {
-			return m.twitchHub.GetSessionId(hubResourceInfo.ResourceInfo)
-		} else {
-			return []string{}
-		}
-	default:
+	resourceHub, ok := m.resourceHubs[hubResourceInfo.ResourceType]
+	if !ok {
 		return []string{}
 	}
+	return resourceHub.GetSessionId(hubResourceInfo.ResourceInfo)
 }
 
 func (m *MessageHub) RemoveSession(sessionId string) {
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
 	delete(m.registeredSessions, sessionId)
-	m.discordHub.RemoveSession(sessionId)
-	m.youtubeHub.RemoveSession(sessionId)
+	delete(m.sessionFilters, sessionId)
+	for _, resourceHub := range m.resourceHubs {
+		resourceHub.RemoveSession(sessionId)
+	}
+	listeners := m.sessionRemovedListeners
+	m.mutex.Unlock()
+	for _, listener := range listeners {
+		listener(sessionId)
+	}
 }
 
 func (m *MessageHub) RegisterSessionResources(sessionId string, resources []models.Resource) {
-	var discordResources []discordsource.DiscordInfo
-	var youtubeResources []youtubesource.YoutubeInfo
-	var twitchResources []twitchsource.TwitchInfo
+	sourceResources := make(map[chat_service.Source][]any)
 	for _, resource := range resources {
-		switch resource.ResourceType {
-		case chat_service.Discord:
-			discordResource, ok := resource.ResourceInfo.(discordsource.DiscordInfo)
-			if ok {
-				discordResources = append(discordResources, discordResource)
-			}
-		case chat_service.Youtube:
-			youtubeResource, ok := resource.ResourceInfo.(youtubesource.YoutubeInfo)
-			if ok {
-				youtubeResources = append(youtubeResources, youtubeResource)
-			}
-		case chat_service.Twitch:
-			twitchResource, ok := resource.ResourceInfo.(twitchsource.TwitchInfo)
-			if ok {
-				twitchResources = append(twitchResources, twitchResource)
-			}
-		default:
-		}
+		sourceResources[resource.ResourceType] = append(sourceResources[resource.ResourceType], resource.ResourceInfo)
 	}
-	if m.discordHub != nil {
-		m.discordHub.RegisterSessionResources(sessionId, discordResources)
-	}
-	if m.youtubeHub != nil {
-		m.youtubeHub.RegisterSessionResources(sessionId, youtubeResources)
-	}
-	if m.twitchHub != nil {
-		m.twitchHub.RegisterSessionResources(sessionId, twitchResources)
+	for source, resourceHub := range m.resourceHubs {
+		resourceHub.RegisterSessionResources(sessionId, sourceResources[source])
 	}
 	m.registeredSessions[sessionId] = true
 
@@ -142,13 +119,54 @@ func (m *MessageHub) AddSession(sessionId string) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	m.registeredSessions[sessionId] = false
-	if m.discordHub != nil {
-		m.discordHub.AddSession(sessionId)
+	for _, resourceHub := range m.resourceHubs {
+		resourceHub.AddSession(sessionId)
 	}
-	if m.youtubeHub != nil {
-		m.youtubeHub.AddSession(sessionId)
+}
+
+func (m *MessageHub) SetSessionModerationRules(sessionId string, rules models.ModerationRules) {
+	filter, err := moderation.NewFilter(rules)
+	if err != nil {
+		fmt.Printf("Invalid moderation rules for session %s: %s\n", sessionId, err.Error())
+		return
 	}
-	if m.twitchHub != nil {
-		m.twitchHub.AddSession(sessionId)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sessionFilters[sessionId] = filter
+}
+
+// OnSessionOff adds a listener called when a registered session is turned off
+func (m *MessageHub) OnSessionOff(listener func(sessionId string)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sessionOffListeners = append(m.sessionOffListeners, listener)
+}
+
+// OnSessionRemoved adds a listener called when a session is removed, once nobody reads it anymore
+func (m *MessageHub) OnSessionRemoved(listener func(sessionId string)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sessionRemovedListeners = append(m.sessionRemovedListeners, listener)
+}
+
+func (m *MessageHub) notifySessionOff(sessionId string) {
+	m.mutex.RLock()
+	listeners := m.sessionOffListeners
+	m.mutex.RUnlock()
+	fmt.Printf("Session %s is off\n", sessionId)
+	for _, listener := range listeners {
+		listener(sessionId)
+	}
+}
+
+// FilterMessage applies the moderation rules of the session to the update.
+// It returns false if the update must not be sent to the session.
+func (m *MessageHub) FilterMessage(sessionId string, msg chat_service.MessageUpdate) (chat_service.MessageUpdate, bool) {
+	m.mutex.RLock()
+	filter := m.sessionFilters[sessionId]
+	m.mutex.RUnlock()
+	if filter == nil {
+		return msg, true
 	}
+	return filter.Apply(msg)
 }
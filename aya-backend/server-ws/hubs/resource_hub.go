@@ -1,7 +1,157 @@
 package hubs
 
+import (
+	"aya-backend/server-ws/chat_service"
+	"fmt"
+	"github.com/fatih/color"
+	"sync"
+)
+
 type SessionResourceHub interface {
 	GetSessionId(resourceInfo any) []string
 	RemoveSession(sessionId string)
 	AddSession(sessionId string)
 }
+
+// ResourceHub keeps track of the sessions subscribing to the resources of a source,
+// and (de)registers the resources to the emitter of the source accordingly.
+type ResourceHub struct {
+	SessionResourceHub
+	mutex            sync.RWMutex
+	plugin           chat_service.SourcePlugin
+	resource2Session map[string]map[string]bool
+	session2Resource map[string]map[string]bool
+	resourceInfos    map[string]any
+	emitter          chat_service.ResourceRegister
+}
+
+func NewResourceHub(plugin chat_service.SourcePlugin, emitter chat_service.ResourceRegister) *ResourceHub {
+	return &ResourceHub{
+		plugin:           plugin,
+		resource2Session: make(map[string]map[string]bool),
+		session2Resource: make(map[string]map[string]bool),
+		resourceInfos:    make(map[string]any),
+		emitter:          emitter,
+	}
+}
+
+func (hub *ResourceHub) GetSessionId(resourceInfo any) []string {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+	resourceKey, err := hub.plugin.ResourceKey(resourceInfo)
+	if err != nil {
+		return []string{}
+	}
+	if hub.resource2Session[resourceKey] == nil {
+		return []string{}
+	}
+	sessions := make([]string, 0, len(hub.resource2Session[resourceKey]))
+	for sessionId := range hub.resource2Session[resourceKey] {
+		sessions = append(sessions, sessionId)
+	}
+	return sessions
+}
+
+func (hub *ResourceHub) RemoveSession(sessionId string) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	if hub.session2Resource[sessionId] == nil {
+		// Do not have to do anything
+		return
+	}
+	for resourceKey := range hub.session2Resource[sessionId] {
+		hub.emitter.Deregister(sessionId, hub.resourceInfos[resourceKey])
+		hub.deregisterSession(sessionId, resourceKey)
+	}
+	delete(hub.session2Resource, sessionId)
+}
+
+func (hub *ResourceHub) AddSession(sessionId string) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+}
+
+func diffResources(
+	oldResources map[string]bool,
+	newResources map[string]bool) (
+	similarResources []string,
+	removeResources []string,
+	addResources []string,
+) {
+	for oldResource := range oldResources {
+		if _, ok := newResources[oldResource]; !ok {
+			removeResources = append(removeResources, oldResource)
+		} else {
+			similarResources = append(similarResources, oldResource)
+		}
+	}
+	for newResource := range newResources {
+		if _, ok := oldResources[newResource]; !ok {
+			addResources = append(addResources, newResource)
+		}
+	}
+	return
+}
+
+func (hub *ResourceHub) RegisterSessionResources(sessionId string, resources []any) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	source := hub.plugin.Source()
+	// get the current resources attached to this session
+	var oldResources = hub.session2Resource[sessionId]
+	if oldResources == nil {
+		oldResources = make(map[string]bool)
+	}
+	newResources := make(map[string]bool)
+	newResourceInfos := make(map[string]any)
+	for _, resourceInfo := range resources {
+		resourceKey, err := hub.plugin.ResourceKey(resourceInfo)
+		if err != nil {
+			fmt.Printf("%s: %s->%s\n", source, sessionId, err.Error())
+			continue
+		}
+		newResources[resourceKey] = true
+		newResourceInfos[resourceKey] = resourceInfo
+	}
+	similarRs, removeRs, addRs := diffResources(oldResources, newResources)
+	for _, similarR := range similarRs {
+		fmt.Printf("%s: %s->%#v\n", source, sessionId, hub.resourceInfos[similarR])
+	}
+	for _, removeR := range removeRs {
+		red := color.New(color.FgRed).SprintfFunc()
+		fmt.Printf("%s: %s->%s\n", source, sessionId, red("-- %#v", hub.resourceInfos[removeR]))
+		hub.emitter.Deregister(sessionId, hub.resourceInfos[removeR])
+		hub.deregisterSession(sessionId, removeR)
+	}
+	for _, addR := range addRs {
+		green := color.New(color.FgGreen).SprintfFunc()
+		fmt.Printf("%s: %s->%s\n", source, sessionId, green("++ %#v", newResourceInfos[addR]))
+		hub.resourceInfos[addR] = newResourceInfos[addR]
+		hub.emitter.Register(sessionId, newResourceInfos[addR])
+		hub.registerSession(sessionId, addR)
+	}
+}
+
+func (hub *ResourceHub) registerSession(sessionId string, resourceKey string) {
+	if hub.session2Resource[sessionId] == nil {
+		hub.session2Resource[sessionId] = make(map[string]bool)
+	}
+	if hub.resource2Session[resourceKey] == nil {
+		hub.resource2Session[resourceKey] = make(map[string]bool)
+	}
+	hub.session2Resource[sessionId][resourceKey] = true
+	hub.resource2Session[resourceKey][sessionId] = true
+}
+
+func (hub *ResourceHub) deregisterSession(sessionId string, resourceKey string) {
+	if hub.session2Resource[sessionId] != nil {
+		delete(hub.session2Resource[sessionId], resourceKey)
+	}
+	if hub.resource2Session[resourceKey] != nil {
+		delete(hub.resource2Session[resourceKey], sessionId)
+		if len(hub.resource2Session[resourceKey]) == 0 {
+			delete(hub.resource2Session, resourceKey)
+			delete(hub.resourceInfos, resourceKey)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package hubs
+
+import "sync"
+
+// SessionSequencer numbers the updates dispatched to each session, so that the
+// clients of a session can tell which updates they missed.
+type SessionSequencer struct {
+	mutex     sync.Mutex
+	sequences map[string]uint64
+}
+
+func NewSessionSequencer() *SessionSequencer {
+	return &SessionSequencer{
+		sequences: make(map[string]uint64),
+	}
+}
+
+// Next returns the sequence number of the next update of the session, starting from 1
+func (sequencer *SessionSequencer) Next(sessionId string) uint64 {
+	sequencer.mutex.Lock()
+	defer sequencer.mutex.Unlock()
+	sequencer.sequences[sessionId]++
+	return sequencer.sequences[sessionId]
+}
+
+// Forget drops the counter of the session, whose numbering starts over from 1 along with its history
+func (sequencer *SessionSequencer) Forget(sessionId string) {
+	sequencer.mutex.Lock()
+	defer sequencer.mutex.Unlock()
+	delete(sequencer.sequences, sessionId)
+}
@@ -2,8 +2,12 @@ package main
 
 import (
 	models "aya-backend/db-models"
+	"aya-backend/server-ws/chat_service"
 	"aya-backend/server-ws/chat_service/composed"
+	"aya-backend/server-ws/db"
 	"aya-backend/server-ws/hubs"
+	"aya-backend/server-ws/processor"
+	"aya-backend/server-ws/sender"
 	"aya-backend/server-ws/socket"
 	"errors"
 	"fmt"
@@ -20,13 +24,17 @@ import (
 )
 
 const (
-	SOURCES_ENV     = "SOURCES"
-	DB_PATH_ENV     = "DB_PATH"
-	SQL_DB_PATH_ENV = "SQL_DB_PATH"
-	DEFAULT_DB_PATH = "data"
-	DB_NAME         = "aya.db"
+	SOURCES_ENV            = "SOURCES"
+	MESSAGE_PROCESSORS_ENV = "MESSAGE_PROCESSORS"
+	DB_PATH_ENV            = "DB_PATH"
+	SQL_DB_PATH_ENV        = "SQL_DB_PATH"
+	DEFAULT_DB_PATH        = "data"
+	DB_NAME                = "aya.db"
 
 	REDIRECT_URL_ENV = "REDIRECT_URL"
+	// INTERNAL_ADDR_ENV is the address of the internal endpoints called by server-api, e.g. :8001.
+	// It should not be exposed, without it the internal endpoints share the public address.
+	INTERNAL_ADDR_ENV = "INTERNAL_ADDR"
 )
 
 func getDB() (*gorm.DB, error) {
@@ -58,23 +66,18 @@ func getDB() (*gorm.DB, error) {
 
 func parseEmitterConfig(msgSettingStr string) *composed.MessageChannelConfig {
 
-	config := composed.MessageChannelConfig{
-		Test:    false,
-		Discord: false,
-		Youtube: false,
-	}
+	config := composed.MessageChannelConfig{}
 	enabledSources := strings.Split(msgSettingStr, " ")
 	for _, enabledSource := range enabledSources {
-		switch enabledSource {
-		case "test_source":
-			config.Test = true
-		case "discord":
-			config.Discord = true
-		case "youtube":
-			config.Youtube = true
-		case "twitch":
-			config.Twitch = true
+		if enabledSource == "" {
+			continue
+		}
+		source, err := chat_service.ParseSource(enabledSource)
+		if err != nil {
+			fmt.Printf("Skipping source: %s\n", err.Error())
+			continue
 		}
+		config.Sources = append(config.Sources, source)
 	}
 
 	return &config
@@ -107,15 +110,38 @@ func main() {
 
 	msgChanEmitter := composed.NewMessageEmitter(msgChanConfig)
 	msgHub := hubs.NewMessageHub(msgChanEmitter, gormDB)
+	msgArchive := db.NewMessageArchive(gormDB)
+	infoDB := db.NewInfoDB(gormDB)
+
+	// the moderation rules of the sessions always apply first
+	processorChain := processor.NewChain(processor.NewModerationProcessor(msgHub))
+	processorChain.RegisterByNames(os.Getenv(MESSAGE_PROCESSORS_ENV))
+	sequencer := hubs.NewSessionSequencer()
+	// the history of a removed session is dropped, so that its numbering starts over
+	msgHub.OnSessionRemoved(sequencer.Forget)
 
 	streamRouter := r.PathPrefix("/stream").Subrouter()
 
-	wsServer, err := socket.NewWSServer(streamRouter, msgHub, msgChanEmitter)
+	wsServer, err := socket.NewWSServer(streamRouter, msgHub, msgChanEmitter, infoDB)
 	if err != nil {
 		fmt.Printf("Error during create the websocket server: %s\n", err.Error())
 		return
 	}
 
+	internalAddr := os.Getenv(INTERNAL_ADDR_ENV)
+	internalRouter := r
+	var internalServer *http.Server
+	if internalAddr == "" {
+		fmt.Printf("%s environment variable not set, the internal endpoints are reachable on the public address\n", INTERNAL_ADDR_ENV)
+	} else {
+		internalRouter = mux.NewRouter()
+		internalServer = &http.Server{
+			Addr:    internalAddr,
+			Handler: internalRouter,
+		}
+	}
+	sender.NewSendServer(internalRouter.PathPrefix("/internal").Subrouter(), infoDB, msgChanEmitter)
+
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 
@@ -131,12 +157,28 @@ func main() {
 					ResourceType: msg.Message.Source,
 					ResourceInfo: msg.ExtraFields,
 				})
-				wsServer.SendMessageToSessions(sessionIds, msg)
+				for _, sessionId := range sessionIds {
+					sessionMsg, ok := processorChain.Process(sessionId, msg)
+					if !ok {
+						continue
+					}
+					// only the updates that are sent are numbered, so that the clients can detect gaps
+					wsServer.SendMessageToSession(sessionId, sequencer.Next(sessionId), sessionMsg)
+					msgArchive.Archive([]string{sessionId}, sessionMsg)
+				}
 			case <-sc:
 				fmt.Println("End Server!")
+				// the websockets are hijacked connections, which the http server does not close
+				wsServer.Close()
 				if err := server.Close(); err != nil {
 					fmt.Printf("Error when closing websocket server: %s\n", err.Error())
 				}
+				if internalServer != nil {
+					if err := internalServer.Close(); err != nil {
+						fmt.Printf("Error when closing internal server: %s\n", err.Error())
+					}
+				}
+				msgArchive.Close()
 				if err := msgChanEmitter.CloseEmitter(); err != nil {
 					fmt.Printf("%s\n", err.Error())
 				}
@@ -145,6 +187,15 @@ func main() {
 
 	}()
 
+	if internalServer != nil {
+		go func() {
+			fmt.Printf("Internal endpoints listening on %s\n", internalAddr)
+			if err := internalServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				fmt.Printf("Internal HTTP server error: %s\n", err.Error())
+			}
+		}()
+	}
+
 	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 		fmt.Printf("HTTP server error: %s\n", err.Error())
 	}
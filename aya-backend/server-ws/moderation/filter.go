@@ -0,0 +1,151 @@
+package moderation
+
+import (
+	models "aya-backend/db-models"
+	. "aya-backend/server-ws/chat_service"
+	"regexp"
+	"strings"
+)
+
+const (
+	LINK_REGEX = `(?i)\b(?:https?://|www\.)\S+|\b[a-z0-9-]+(?:\.[a-z0-9-]+)*\.(?:com|net|org|io|gg|tv|ly|me|co)\b`
+)
+
+var (
+	linkRegex = regexp.MustCompile(LINK_REGEX)
+
+	// roles given by the badges of the sources
+	badgeRoles = map[string]models.Role{
+		"broadcaster": models.RoleBroadcaster,
+		"owner":       models.RoleBroadcaster,
+		"moderator":   models.RoleModerator,
+		"vip":         models.RoleVip,
+		"subscriber":  models.RoleSubscriber,
+		"founder":     models.RoleSubscriber,
+		"member":      models.RoleSubscriber,
+	}
+)
+
+// Filter hides the messages that break the moderation rules of a session
+type Filter struct {
+	rules          models.ModerationRules
+	bannedWords    *regexp.Regexp
+	bannedRegexes  []*regexp.Regexp
+	blockedAuthors map[Source]map[string]bool
+}
+
+func NewFilter(rules models.ModerationRules) (*Filter, error) {
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	filter := Filter{
+		rules:          rules,
+		blockedAuthors: make(map[Source]map[string]bool),
+	}
+
+	var quotedWords []string
+	for _, bannedWord := range rules.BannedWords {
+		if bannedWord = strings.TrimSpace(bannedWord); bannedWord != "" {
+			quotedWords = append(quotedWords, regexp.QuoteMeta(bannedWord))
+		}
+	}
+	if len(quotedWords) > 0 {
+		filter.bannedWords = regexp.MustCompile(`(?i)(?:^|[^\pL\pN])(?:` + strings.Join(quotedWords, "|") + `)(?:$|[^\pL\pN])`)
+	}
+	for _, bannedRegex := range rules.BannedRegexes {
+		filter.bannedRegexes = append(filter.bannedRegexes, regexp.MustCompile(bannedRegex))
+	}
+	for source, authors := range rules.BlockedAuthors {
+		filter.blockedAuthors[source] = make(map[string]bool)
+		for _, author := range authors {
+			filter.blockedAuthors[source][strings.ToLower(author)] = true
+		}
+	}
+	return &filter, nil
+}
+
+// authorRole returns the highest role of the author. Admins are at least moderators.
+func authorRole(author Author) models.Role {
+	role := models.RoleEveryone
+	if author.IsAdmin {
+		role = models.RoleModerator
+	}
+	for _, badge := range author.Badges {
+		if badgeRole, ok := badgeRoles[badge.Name]; ok && badgeRole.Rank() > role.Rank() {
+			role = badgeRole
+		}
+	}
+	return role
+}
+
+func messageText(msg Message) string {
+	var text strings.Builder
+	for _, part := range msg.MessageParts {
+		text.WriteString(part.Content)
+	}
+	return text.String()
+}
+
+func hasLink(msg Message) bool {
+	for _, part := range msg.MessageParts {
+		if part.Format != nil && part.Format.Link != "" {
+			return true
+		}
+		if linkRegex.MatchString(part.Content) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows checks the message against the rules
+func (filter *Filter) Allows(msg Message) bool {
+	author := msg.Author
+	if blockedAuthors := filter.blockedAuthors[msg.Source]; blockedAuthors != nil {
+		if blockedAuthors[strings.ToLower(author.Id)] || blockedAuthors[strings.ToLower(author.Username)] {
+			return false
+		}
+	}
+	if filter.rules.HideBots && author.IsBot {
+		return false
+	}
+	if authorRole(author).Rank() < filter.rules.MinimumRole.Rank() {
+		return false
+	}
+	if filter.rules.HideLinks && hasLink(msg) {
+		return false
+	}
+
+	text := messageText(msg)
+	if filter.bannedWords != nil && filter.bannedWords.MatchString(text) {
+		return false
+	}
+	for _, bannedRegex := range filter.bannedRegexes {
+		if bannedRegex.MatchString(text) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns the update to send to the session, or false if nothing should be sent.
+// A message that breaks the rules after being edited is deleted from the session.
+func (filter *Filter) Apply(msgUpdate MessageUpdate) (MessageUpdate, bool) {
+	switch msgUpdate.Update {
+	case New:
+		return msgUpdate, filter.Allows(msgUpdate.Message)
+	case Edit:
+		if filter.Allows(msgUpdate.Message) {
+			return msgUpdate, true
+		}
+		deleteUpdate := msgUpdate
+		deleteUpdate.Update = Delete
+		deleteUpdate.Message = Message{
+			Source: msgUpdate.Message.Source,
+			Id:     msgUpdate.Message.Id,
+		}
+		return deleteUpdate, true
+	default:
+		return msgUpdate, true
+	}
+}
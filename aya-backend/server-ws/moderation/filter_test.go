@@ -0,0 +1,102 @@
+package moderation
+
+import (
+	models "aya-backend/db-models"
+	. "aya-backend/server-ws/chat_service"
+	"testing"
+)
+
+func testMessage(author Author, parts ...MessagePart) Message {
+	return Message{Source: Source("twitch"), Id: "1", Author: author, MessageParts: parts}
+}
+
+func text(content string) MessagePart {
+	return MessagePart{Content: content}
+}
+
+func TestFilterAllows(t *testing.T) {
+	alice := Author{Id: "1", Username: "alice"}
+	moderator := Author{Id: "2", Username: "mod", Badges: []Badge{{Name: "moderator"}}}
+	owner := Author{Id: "3", Username: "owner", Badges: []Badge{{Name: "owner"}}}
+	subscriber := Author{Id: "4", Username: "sub", Badges: []Badge{{Name: "subscriber"}, {Name: "vip"}}}
+	admin := Author{Id: "5", Username: "admin", IsAdmin: true}
+	bot := Author{Id: "6", Username: "bot", IsBot: true}
+
+	tests := []struct {
+		name    string
+		rules   models.ModerationRules
+		message Message
+		want    bool
+	}{
+		{name: "no rules", message: testMessage(alice, text("hello")), want: true},
+
+		{name: "banned word", rules: models.ModerationRules{BannedWords: []string{"spam"}}, message: testMessage(alice, text("buy SPAM now")), want: false},
+		{name: "banned word inside a word", rules: models.ModerationRules{BannedWords: []string{"spam"}}, message: testMessage(alice, text("spammer")), want: true},
+		{name: "banned word across parts", rules: models.ModerationRules{BannedWords: []string{"spam"}}, message: testMessage(alice, text("sp"), text("am")), want: false},
+		{name: "banned word with symbols", rules: models.ModerationRules{BannedWords: []string{"a.b"}}, message: testMessage(alice, text("axb")), want: true},
+		{name: "blank banned word", rules: models.ModerationRules{BannedWords: []string{" "}}, message: testMessage(alice, text("a b")), want: true},
+
+		{name: "blocked author id", rules: models.ModerationRules{BlockedAuthors: map[Source][]string{"twitch": {"1"}}}, message: testMessage(alice, text("hi")), want: false},
+		{name: "blocked author name", rules: models.ModerationRules{BlockedAuthors: map[Source][]string{"twitch": {"ALICE"}}}, message: testMessage(alice, text("hi")), want: false},
+		{name: "author blocked on another source", rules: models.ModerationRules{BlockedAuthors: map[Source][]string{"discord": {"alice"}}}, message: testMessage(alice, text("hi")), want: true},
+		{name: "hidden bot", rules: models.ModerationRules{HideBots: true}, message: testMessage(bot, text("hi")), want: false},
+
+		{name: "link", rules: models.ModerationRules{HideLinks: true}, message: testMessage(alice, text("see https://example.com")), want: false},
+		{name: "bare domain", rules: models.ModerationRules{HideLinks: true}, message: testMessage(alice, text("go to example.gg")), want: false},
+		{name: "formatted link", rules: models.ModerationRules{HideLinks: true}, message: testMessage(alice, MessagePart{Content: "here", Format: &Format{Link: "https://example.com"}}), want: false},
+		{name: "no link", rules: models.ModerationRules{HideLinks: true}, message: testMessage(alice, text("end of sentence.next")), want: true},
+
+		{name: "everyone below moderator", rules: models.ModerationRules{MinimumRole: models.RoleModerator}, message: testMessage(alice, text("hi")), want: false},
+		{name: "subscriber below moderator", rules: models.ModerationRules{MinimumRole: models.RoleModerator}, message: testMessage(subscriber, text("hi")), want: false},
+		{name: "vip badge as subscriber", rules: models.ModerationRules{MinimumRole: models.RoleSubscriber}, message: testMessage(subscriber, text("hi")), want: true},
+		{name: "moderator", rules: models.ModerationRules{MinimumRole: models.RoleModerator}, message: testMessage(moderator, text("hi")), want: true},
+		{name: "admin as moderator", rules: models.ModerationRules{MinimumRole: models.RoleModerator}, message: testMessage(admin, text("hi")), want: true},
+		{name: "admin below broadcaster", rules: models.ModerationRules{MinimumRole: models.RoleBroadcaster}, message: testMessage(admin, text("hi")), want: false},
+		{name: "owner as broadcaster", rules: models.ModerationRules{MinimumRole: models.RoleBroadcaster}, message: testMessage(owner, text("hi")), want: true},
+
+		{name: "banned regex", rules: models.ModerationRules{BannedRegexes: []string{`(?i)free\s+nitro`}}, message: testMessage(alice, text("FREE   nitro here")), want: false},
+		{name: "banned regex not matching", rules: models.ModerationRules{BannedRegexes: []string{`^!`}}, message: testMessage(alice, text("hi !cmd")), want: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := NewFilter(test.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filter.Allows(test.message); got != test.want {
+				t.Errorf("Allows = %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewFilterRejectsInvalidRules(t *testing.T) {
+	for _, rules := range []models.ModerationRules{
+		{BannedRegexes: []string{"("}},
+		{MinimumRole: models.Role("king")},
+	} {
+		if _, err := NewFilter(rules); err == nil {
+			t.Errorf("rules %v are accepted", rules)
+		}
+	}
+}
+
+func TestFilterApply(t *testing.T) {
+	filter, err := NewFilter(models.ModerationRules{BannedWords: []string{"spam"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Author{Id: "1", Username: "alice"}
+
+	if _, ok := filter.Apply(MessageUpdate{Update: New, Message: testMessage(alice, text("spam"))}); ok {
+		t.Error("new message breaking the rules is sent")
+	}
+	// an edited message breaking the rules is deleted from the session
+	update, ok := filter.Apply(MessageUpdate{Update: Edit, Message: testMessage(alice, text("spam"))})
+	if !ok || update.Update != Delete || update.Message.Id != "1" || len(update.Message.MessageParts) != 0 {
+		t.Errorf("edit breaking the rules gives %v, %t, want a delete", update, ok)
+	}
+	if update, ok := filter.Apply(MessageUpdate{Update: Delete, Message: testMessage(alice)}); !ok || update.Update != Delete {
+		t.Error("delete is not sent")
+	}
+}
@@ -0,0 +1,217 @@
+package processor
+
+import (
+	. "aya-backend/server-ws/chat_service"
+	"fmt"
+	"strings"
+)
+
+const (
+	EMOJI_PROCESSOR = "emoji"
+
+	TWEMOJI_URL_FORMAT = "https://cdn.jsdelivr.net/gh/jdecked/twemoji@latest/assets/72x72/%s.png"
+
+	zeroWidthJoiner    = 0x200D
+	variationSelector  = 0xFE0F
+	textPresentation   = 0xFE0E
+	combiningKeycap    = 0x20E3
+	regionalIndicatorA = 0x1F1E6
+	regionalIndicatorZ = 0x1F1FF
+)
+
+type runeRange struct {
+	low  rune
+	high rune
+}
+
+var (
+	// ranges of the runes that are displayed as emojis on their own
+	emojiRanges = []runeRange{
+		{0x1F000, 0x1FAFF},
+		{0x231A, 0x231B}, {0x23E9, 0x23EC}, {0x23F0, 0x23F0}, {0x23F3, 0x23F3},
+		{0x25FD, 0x25FE}, {0x2614, 0x2615}, {0x2648, 0x2653}, {0x267F, 0x267F},
+		{0x2693, 0x2693}, {0x26A1, 0x26A1}, {0x26AA, 0x26AB}, {0x26BD, 0x26BE},
+		{0x26C4, 0x26C5}, {0x26CE, 0x26CE}, {0x26D4, 0x26D4}, {0x26EA, 0x26EA},
+		{0x26F2, 0x26F3}, {0x26F5, 0x26F5}, {0x26FA, 0x26FA}, {0x26FD, 0x26FD},
+		{0x2705, 0x2705}, {0x270A, 0x270B}, {0x2728, 0x2728}, {0x274C, 0x274C},
+		{0x274E, 0x274E}, {0x2753, 0x2755}, {0x2757, 0x2757}, {0x2795, 0x2797},
+		{0x27B0, 0x27B0}, {0x27BF, 0x27BF}, {0x2B1B, 0x2B1C}, {0x2B50, 0x2B50},
+		{0x2B55, 0x2B55},
+	}
+	// ranges of the symbols that are only displayed as emojis when followed by a variation selector
+	textEmojiRanges = []runeRange{
+		{0x00A9, 0x00A9}, {0x00AE, 0x00AE}, {0x203C, 0x203C}, {0x2049, 0x2049},
+		{0x2122, 0x2122}, {0x2139, 0x2139}, {0x2194, 0x21AA}, {0x2328, 0x23FF},
+		{0x24C2, 0x24C2}, {0x25AA, 0x25FE}, {0x2600, 0x27BF}, {0x2934, 0x2935},
+		{0x2B05, 0x2B07}, {0x3030, 0x3030}, {0x303D, 0x303D}, {0x3297, 0x3299},
+	}
+)
+
+// emojiProcessor turns the unicode emojis in the text of the messages into emoji parts
+// with an image, so that they look the same whatever the platform they come from.
+type emojiProcessor struct{}
+
+func init() {
+	RegisterProcessor(EMOJI_PROCESSOR, func() (MessageProcessor, error) {
+		return emojiProcessor{}, nil
+	})
+}
+
+func inRanges(r rune, ranges []runeRange) bool {
+	for _, runeRange := range ranges {
+		if r >= runeRange.low && r <= runeRange.high {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmojiAt checks whether the rune at the index starts an emoji, other than a flag or a keycap
+func isEmojiAt(runes []rune, i int) bool {
+	if inRanges(runes[i], emojiRanges) {
+		return true
+	}
+	return inRanges(runes[i], textEmojiRanges) && i+1 < len(runes) && runes[i+1] == variationSelector
+}
+
+func isEmojiModifier(r rune) bool {
+	return r == variationSelector ||
+		r == combiningKeycap ||
+		// skin tones
+		(r >= 0x1F3FB && r <= 0x1F3FF) ||
+		// tags of the subdivision flags
+		(r >= 0xE0020 && r <= 0xE007F)
+}
+
+// emojiLength returns the number of runes of the emoji starting at start, or 0 if there is none
+func emojiLength(runes []rune, start int) int {
+	r := runes[start]
+	if r >= regionalIndicatorA && r <= regionalIndicatorZ {
+		// flags are pairs of regional indicators
+		if start+1 < len(runes) && runes[start+1] >= regionalIndicatorA && runes[start+1] <= regionalIndicatorZ {
+			return 2
+		}
+		return 0
+	}
+	isKeycap := (r >= '0' && r <= '9') || r == '#' || r == '*'
+	if isKeycap {
+		if start+2 < len(runes) && runes[start+1] == variationSelector && runes[start+2] == combiningKeycap {
+			return 3
+		}
+		return 0
+	}
+	if !isEmojiAt(runes, start) {
+		return 0
+	}
+
+	end := start + 1
+	for end < len(runes) {
+		switch {
+		case runes[end] == textPresentation:
+			// the emoji is explicitly displayed as text
+			return 0
+		case isEmojiModifier(runes[end]):
+			end++
+		case runes[end] == zeroWidthJoiner && end+1 < len(runes) && (isEmojiAt(runes, end+1) || inRanges(runes[end+1], textEmojiRanges)):
+			end += 2
+		default:
+			return end - start
+		}
+	}
+	return end - start
+}
+
+// twemojiUrl returns the image of the emoji. The variation selectors are not part of
+// the file names, unless the emoji is a sequence joined by zero width joiners.
+func twemojiUrl(emoji string) string {
+	keepSelector := strings.ContainsRune(emoji, zeroWidthJoiner)
+	var codePoints []string
+	for _, r := range emoji {
+		if r == variationSelector && !keepSelector {
+			continue
+		}
+		codePoints = append(codePoints, fmt.Sprintf("%x", r))
+	}
+	return fmt.Sprintf(TWEMOJI_URL_FORMAT, strings.Join(codePoints, "-"))
+}
+
+func splitEmojis(part MessagePart) []MessagePart {
+	runes := []rune(part.Content)
+	var parts []MessagePart
+	textStart := 0
+	for i := 0; i < len(runes); {
+		length := emojiLength(runes, i)
+		if length == 0 {
+			i++
+			continue
+		}
+		if i > textStart {
+			textPart := part
+			textPart.Content = string(runes[textStart:i])
+			parts = append(parts, textPart)
+		}
+		emoji := string(runes[i : i+length])
+		parts = append(parts, MessagePart{
+			Emoji: &Emoji{
+				Id:  twemojiUrl(emoji),
+				Alt: emoji,
+			},
+			Format: part.Format,
+		})
+		i += length
+		textStart = i
+	}
+	if textStart == 0 {
+		return []MessagePart{part}
+	}
+	if textStart < len(runes) {
+		textPart := part
+		textPart.Content = string(runes[textStart:])
+		parts = append(parts, textPart)
+	}
+	return parts
+}
+
+// normalizeEmoji sets the image of the unicode emojis, which the platforms send without one
+func normalizeEmoji(emoji Emoji) Emoji {
+	if emoji.Id != "" {
+		return emoji
+	}
+	runes := []rune(emoji.Alt)
+	if len(runes) > 0 && emojiLength(runes, 0) == len(runes) {
+		emoji.Id = twemojiUrl(emoji.Alt)
+	}
+	return emoji
+}
+
+func (processor emojiProcessor) Name() string {
+	return EMOJI_PROCESSOR
+}
+
+func (processor emojiProcessor) Process(sessionId string, msg MessageUpdate) (MessageUpdate, bool) {
+	if msg.Message.MessageParts != nil {
+		var messageParts []MessagePart
+		for _, part := range msg.Message.MessageParts {
+			if part.Emoji != nil || (part.Format != nil && part.Format.Code) {
+				messageParts = append(messageParts, part)
+				continue
+			}
+			messageParts = append(messageParts, splitEmojis(part)...)
+		}
+		msg.Message.MessageParts = messageParts
+	}
+	if msg.Message.Reactions != nil {
+		reactions := make([]MessageReaction, len(msg.Message.Reactions))
+		for i, reaction := range msg.Message.Reactions {
+			reaction.Emoji = normalizeEmoji(reaction.Emoji)
+			reactions[i] = reaction
+		}
+		msg.Message.Reactions = reactions
+	}
+	if msg.Reaction != nil {
+		reaction := *msg.Reaction
+		reaction.Emoji = normalizeEmoji(reaction.Emoji)
+		msg.Reaction = &reaction
+	}
+	return msg, true
+}
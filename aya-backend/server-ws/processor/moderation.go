@@ -0,0 +1,30 @@
+package processor
+
+import (
+	. "aya-backend/server-ws/chat_service"
+)
+
+const MODERATION_PROCESSOR = "moderation"
+
+// MessageFilter applies the moderation rules of the sessions, e.g. the message hub
+type MessageFilter interface {
+	FilterMessage(sessionId string, msg MessageUpdate) (MessageUpdate, bool)
+}
+
+// moderationProcessor drops or edits the updates according to the moderation rules of the
+// session. It is not registered by name, since it needs the filter holding the rules.
+type moderationProcessor struct {
+	filter MessageFilter
+}
+
+func NewModerationProcessor(filter MessageFilter) MessageProcessor {
+	return &moderationProcessor{filter: filter}
+}
+
+func (processor *moderationProcessor) Name() string {
+	return MODERATION_PROCESSOR
+}
+
+func (processor *moderationProcessor) Process(sessionId string, msg MessageUpdate) (MessageUpdate, bool) {
+	return processor.filter.FilterMessage(sessionId, msg)
+}
@@ -0,0 +1,124 @@
+package processor
+
+import (
+	. "aya-backend/server-ws/chat_service"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// MessageProcessor transforms, enriches or drops the updates sent to a session.
+// Processors must not modify the slices of the update in place, since the same
+// update is processed for every session subscribing to the resource.
+type MessageProcessor interface {
+	// Name of the processor, as used in the MESSAGE_PROCESSORS environment variable
+	Name() string
+	// Process returns the update to send to the session, or false if it must be dropped
+	Process(sessionId string, msg MessageUpdate) (MessageUpdate, bool)
+}
+
+// ProcessorFactory creates a processor, usually configured from environment variables
+type ProcessorFactory func() (MessageProcessor, error)
+
+var (
+	processorFactoriesMutex sync.RWMutex
+	processorFactories      = make(map[string]ProcessorFactory)
+)
+
+// RegisterProcessor makes a processor available to the chains. It panics if the
+// processor is registered twice.
+func RegisterProcessor(name string, factory ProcessorFactory) {
+	processorFactoriesMutex.Lock()
+	defer processorFactoriesMutex.Unlock()
+	if _, ok := processorFactories[name]; ok {
+		panic(fmt.Sprintf("processor \"%s\" is already registered", name))
+	}
+	processorFactories[name] = factory
+}
+
+// RegisteredProcessors returns the name of every registered processor, sorted
+func RegisteredProcessors() []string {
+	processorFactoriesMutex.RLock()
+	defer processorFactoriesMutex.RUnlock()
+	names := make([]string, 0, len(processorFactories))
+	for name := range processorFactories {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func NewProcessor(name string) (MessageProcessor, error) {
+	processorFactoriesMutex.RLock()
+	factory, ok := processorFactories[name]
+	processorFactoriesMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("processor \"%s\" is not registered", name)
+	}
+	return factory()
+}
+
+// Chain runs the updates through its processors in order, stopping at the first processor dropping it
+type Chain struct {
+	mutex      sync.RWMutex
+	processors []MessageProcessor
+}
+
+func NewChain(processors ...MessageProcessor) *Chain {
+	return &Chain{
+		processors: processors,
+	}
+}
+
+// Register adds the processor at the end of the chain
+func (chain *Chain) Register(processor MessageProcessor) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	chain.processors = append(chain.processors, processor)
+}
+
+// RegisterByNames creates the registered processors from a space separated list of names,
+// and adds them at the end of the chain. Unknown processors are skipped.
+func (chain *Chain) RegisterByNames(names string) {
+	for _, name := range strings.Split(names, " ") {
+		if name == "" {
+			continue
+		}
+		processor, err := NewProcessor(name)
+		if err != nil {
+			fmt.Printf("Skipping processor: %s\n", err.Error())
+			continue
+		}
+		chain.Register(processor)
+		fmt.Printf("Processor %s registered\n", name)
+	}
+}
+
+func (chain *Chain) Process(sessionId string, msg MessageUpdate) (MessageUpdate, bool) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+	for _, processor := range chain.processors {
+		var ok bool
+		if msg, ok = processor.Process(sessionId, msg); !ok {
+			return msg, false
+		}
+	}
+	return msg, true
+}
+
+// mapTextParts returns a copy of the message parts with the content of the text parts
+// replaced. Code is kept as it is.
+func mapTextParts(messageParts []MessagePart, mapContent func(content string) string) []MessagePart {
+	if messageParts == nil {
+		return nil
+	}
+	mappedParts := make([]MessagePart, len(messageParts))
+	for i, part := range messageParts {
+		mappedParts[i] = part
+		if part.Emoji == nil && (part.Format == nil || !part.Format.Code) {
+			mappedParts[i].Content = mapContent(part.Content)
+		}
+	}
+	return mappedParts
+}
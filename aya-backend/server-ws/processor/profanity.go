@@ -0,0 +1,74 @@
+package processor
+
+import (
+	. "aya-backend/server-ws/chat_service"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	PROFANITY_PROCESSOR = "profanity"
+
+	PROFANITY_WORDS_ENV = "PROFANITY_WORDS"
+	PROFANITY_MASK      = "*"
+)
+
+var (
+	defaultProfanityWords = []string{
+		"fuck", "fucking", "shit", "bitch", "cunt", "asshole", "bastard", "dick", "motherfucker",
+	}
+)
+
+// profanityProcessor masks the profanities in the text of the messages, keeping their first letter
+type profanityProcessor struct {
+	profanityRegex *regexp.Regexp
+}
+
+func init() {
+	RegisterProcessor(PROFANITY_PROCESSOR, func() (MessageProcessor, error) {
+		words := defaultProfanityWords
+		if wordsStr := os.Getenv(PROFANITY_WORDS_ENV); wordsStr != "" {
+			words = strings.Split(wordsStr, ",")
+		}
+		return newProfanityProcessor(words), nil
+	})
+}
+
+func newProfanityProcessor(words []string) *profanityProcessor {
+	var quotedWords []string
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quotedWords = append(quotedWords, regexp.QuoteMeta(word))
+		}
+	}
+	processor := profanityProcessor{}
+	if len(quotedWords) > 0 {
+		processor.profanityRegex = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quotedWords, "|") + `)\b`)
+	}
+	return &processor
+}
+
+func (processor *profanityProcessor) Name() string {
+	return PROFANITY_PROCESSOR
+}
+
+func (processor *profanityProcessor) mask(content string) string {
+	return processor.profanityRegex.ReplaceAllStringFunc(content, func(word string) string {
+		runes := []rune(word)
+		return string(runes[0]) + strings.Repeat(PROFANITY_MASK, len(runes)-1)
+	})
+}
+
+func (processor *profanityProcessor) Process(sessionId string, msg MessageUpdate) (MessageUpdate, bool) {
+	if processor.profanityRegex == nil {
+		return msg, true
+	}
+	msg.Message.MessageParts = mapTextParts(msg.Message.MessageParts, processor.mask)
+	if msg.Message.ReplyTo != nil {
+		replyTo := *msg.Message.ReplyTo
+		replyTo.Preview = processor.mask(replyTo.Preview)
+		msg.Message.ReplyTo = &replyTo
+	}
+	return msg, true
+}
@@ -0,0 +1,64 @@
+package processor
+
+import (
+	. "aya-backend/server-ws/chat_service"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const (
+	TRUNCATE_PROCESSOR = "truncate"
+
+	MAX_MESSAGE_LENGTH_ENV     = "MAX_MESSAGE_LENGTH"
+	DEFAULT_MAX_MESSAGE_LENGTH = 500
+)
+
+// truncateProcessor shortens the messages to a maximum number of runes. Each emoji counts as one rune.
+type truncateProcessor struct {
+	maxLength int
+}
+
+func init() {
+	RegisterProcessor(TRUNCATE_PROCESSOR, func() (MessageProcessor, error) {
+		maxLength := DEFAULT_MAX_MESSAGE_LENGTH
+		if maxLengthStr := os.Getenv(MAX_MESSAGE_LENGTH_ENV); maxLengthStr != "" {
+			var err error
+			maxLength, err = strconv.Atoi(maxLengthStr)
+			if err != nil || maxLength <= 0 {
+				return nil, fmt.Errorf("invalid %s value \"%s\"", MAX_MESSAGE_LENGTH_ENV, maxLengthStr)
+			}
+		}
+		return &truncateProcessor{maxLength: maxLength}, nil
+	})
+}
+
+func (processor *truncateProcessor) Name() string {
+	return TRUNCATE_PROCESSOR
+}
+
+func (processor *truncateProcessor) Process(sessionId string, msg MessageUpdate) (MessageUpdate, bool) {
+	length := 0
+	for i, part := range msg.Message.MessageParts {
+		partLength := 1
+		if part.Emoji == nil {
+			partLength = len([]rune(part.Content))
+		}
+		if length+partLength <= processor.maxLength {
+			length += partLength
+			continue
+		}
+
+		truncatedParts := make([]MessagePart, i, i+1)
+		copy(truncatedParts, msg.Message.MessageParts[:i])
+		if remaining := processor.maxLength - length; part.Emoji == nil && remaining > 0 {
+			part.Content = TruncateText(part.Content, remaining)
+			truncatedParts = append(truncatedParts, part)
+		} else {
+			truncatedParts = append(truncatedParts, MessagePart{Content: ELLIPSIS})
+		}
+		msg.Message.MessageParts = truncatedParts
+		break
+	}
+	return msg, true
+}
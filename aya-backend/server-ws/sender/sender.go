@@ -0,0 +1,203 @@
+package sender
+
+import (
+	models "aya-backend/db-models"
+	"aya-backend/server-ws/chat_service"
+	"aya-backend/server-ws/chat_service/composed"
+	"aya-backend/server-ws/db"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/gorilla/mux"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MAX_SENT_MESSAGE_LENGTH = 500
+
+	// SEND_ALLOWED_RESOURCES_ENV lists the resources the bots may post to, as comma separated
+	// source:key entries, e.g. discord:<guild id>/<channel id>,twitch:<channel>. An entry
+	// source:* allows every resource of the source. The owner of a session is not checked
+	// against the platforms, so nothing can be sent when it is not set.
+	SEND_ALLOWED_RESOURCES_ENV = "SEND_ALLOWED_RESOURCES"
+
+	ALLOW_EVERY_RESOURCE = "*"
+)
+
+// SendRequest asks to post the text to the resources of a session, or only to those of the
+// sources or to the resource with the key if set
+type SendRequest struct {
+	SessionId   string                `json:"sessionId"`
+	Text        string                `json:"text"`
+	Sources     []chat_service.Source `json:"sources,omitempty"`
+	ResourceKey string                `json:"resourceKey,omitempty"`
+}
+
+type SendResult struct {
+	ResourceType chat_service.Source `json:"resourceType"`
+	ResourceInfo any                 `json:"resourceInfo"`
+	ResourceKey  string              `json:"resourceKey,omitempty"`
+	Err          string              `json:"err,omitempty"`
+}
+
+type SendResponse struct {
+	Results []SendResult `json:"results"`
+	Err     string       `json:"err,omitempty"`
+}
+
+type SendServer struct {
+	infoDB  *db.InfoDB
+	emitter *composed.MessageEmitter
+	secret  string
+	// allowedResources holds the source:key entries of the resources that can be sent to
+	allowedResources map[string]bool
+}
+
+func getAllowedResources() map[string]bool {
+	allowedResources := make(map[string]bool)
+	for _, entry := range strings.Split(os.Getenv(SEND_ALLOWED_RESOURCES_ENV), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if source, key, ok := strings.Cut(entry, ":"); !ok || source == "" || key == "" {
+			fmt.Printf("Invalid %s entry \"%s\", expected source:key\n", SEND_ALLOWED_RESOURCES_ENV, entry)
+			continue
+		}
+		allowedResources[entry] = true
+	}
+	if len(allowedResources) == 0 {
+		fmt.Printf("%s environment variable not set, messages cannot be sent to any resource\n", SEND_ALLOWED_RESOURCES_ENV)
+	}
+	return allowedResources
+}
+
+// isAllowed checks that the deployment allows the bots to post to the resource
+func (sendServer *SendServer) isAllowed(source chat_service.Source, key string) bool {
+	return sendServer.allowedResources[fmt.Sprintf("%s:%s", source, key)] ||
+		sendServer.allowedResources[fmt.Sprintf("%s:%s", source, ALLOW_EVERY_RESOURCE)]
+}
+
+func writeResponse(writer http.ResponseWriter, status int, response SendResponse) {
+	if response.Results == nil {
+		response.Results = []SendResult{}
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(response)
+}
+
+func (sendServer *SendServer) secretMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		secret := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(sendServer.secret)) != 1 {
+			writeResponse(writer, http.StatusUnauthorized, SendResponse{Err: "Invalid secret!"})
+			return
+		}
+		next.ServeHTTP(writer, req)
+	})
+}
+
+// Send posts the text to every matching resource of the session. The resources are
+// sent to independently, so the result of each one is returned.
+func (sendServer *SendServer) Send(request SendRequest) []SendResult {
+	var results []SendResult
+	for _, resource := range sendServer.infoDB.GetResourcesOfSession(request.SessionId) {
+		if len(request.Sources) > 0 && !slices.Contains(request.Sources, resource.ResourceType) {
+			continue
+		}
+		key, keyErr := chat_service.GetResourceKey(resource.ResourceType, resource.ResourceInfo)
+		if request.ResourceKey != "" && (keyErr != nil || key != request.ResourceKey) {
+			continue
+		}
+		result := SendResult{
+			ResourceType: resource.ResourceType,
+			ResourceInfo: resource.ResourceInfo,
+			ResourceKey:  key,
+		}
+		emitter, ok := sendServer.emitter.GetEmitter(resource.ResourceType)
+		chatSender, isSender := emitter.(chat_service.ChatSender)
+		switch {
+		case keyErr != nil:
+			result.Err = keyErr.Error()
+		case !sendServer.isAllowed(resource.ResourceType, key):
+			result.Err = fmt.Sprintf("sending to %s resource %s is not allowed", resource.ResourceType, key)
+		case !ok:
+			result.Err = fmt.Sprintf("source %s is not enabled", resource.ResourceType)
+		case !isSender:
+			result.Err = fmt.Sprintf("source %s cannot send messages", resource.ResourceType)
+		default:
+			if err := chatSender.SendMessage(resource.ResourceInfo, request.Text); err != nil {
+				result.Err = err.Error()
+			}
+		}
+		if result.Err != "" {
+			color.Red("Cannot send message of session %s to %s: %s\n", request.SessionId, resource.ResourceType, result.Err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (sendServer *SendServer) handleSend(writer http.ResponseWriter, req *http.Request) {
+	var request SendRequest
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		writeResponse(writer, http.StatusBadRequest, SendResponse{Err: "Cannot parse payload content"})
+		return
+	}
+	request.Text = strings.TrimSpace(request.Text)
+	if request.SessionId == "" {
+		writeResponse(writer, http.StatusBadRequest, SendResponse{Err: "session id is required"})
+		return
+	}
+	if request.Text == "" {
+		writeResponse(writer, http.StatusBadRequest, SendResponse{Err: "text is required"})
+		return
+	}
+	if utf8.RuneCountInString(request.Text) > MAX_SENT_MESSAGE_LENGTH {
+		writeResponse(writer, http.StatusBadRequest, SendResponse{Err: fmt.Sprintf("text is longer than %d characters", MAX_SENT_MESSAGE_LENGTH)})
+		return
+	}
+
+	results := sendServer.Send(request)
+	if len(results) == 0 {
+		writeResponse(writer, http.StatusNotFound, SendResponse{Err: "session is off or has no matching resources"})
+		return
+	}
+	for _, result := range results {
+		if result.Err == "" {
+			writeResponse(writer, http.StatusOK, SendResponse{Results: results})
+			return
+		}
+	}
+	writeResponse(writer, http.StatusBadGateway, SendResponse{Results: results, Err: "message could not be sent to any resource"})
+}
+
+// NewSendServer sets up the internal endpoint used by server-api to post messages
+// to the platforms. The endpoint is only set up when the shared secret is set, since
+// it can be reachable from outside when the internal endpoints share the public address.
+func NewSendServer(r *mux.Router, infoDB *db.InfoDB, emitter *composed.MessageEmitter) *SendServer {
+	sendServer := SendServer{
+		infoDB:  infoDB,
+		emitter: emitter,
+		secret:  os.Getenv(models.INTERNAL_API_SECRET_ENV),
+	}
+	if sendServer.secret == "" {
+		fmt.Printf("%s environment variable not set, sending messages is disabled\n", models.INTERNAL_API_SECRET_ENV)
+		return &sendServer
+	}
+	sendServer.allowedResources = getAllowedResources()
+
+	r.Use(sendServer.secretMiddleware)
+	r.Path("/send").
+		Methods(http.MethodPost).
+		HandlerFunc(sendServer.handleSend)
+
+	fmt.Println("Finished setting up /internal/send")
+	return &sendServer
+}
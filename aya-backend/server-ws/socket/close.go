@@ -0,0 +1,45 @@
+package socket
+
+import (
+	"errors"
+	"fmt"
+	ws "github.com/gorilla/websocket"
+	"time"
+)
+
+// Close codes sent to the clients, so that they know whether to reconnect. Besides
+// these, the server closes with 1001 (going away) when it shuts down, and with 1013
+// (try again later) when the client is too slow to keep up with the messages.
+const (
+	// CloseSessionOff is sent when the session is turned off, the client should not reconnect until it is on again
+	CloseSessionOff = 4000
+	// CloseInvalidToken is sent when the token is missing, malformed, badly signed or expired
+	CloseInvalidToken = 4001
+	// CloseForbiddenToken is sent when the token is revoked or issued for another session
+	CloseForbiddenToken = 4003
+)
+
+var (
+	errServerShutdown = &closeError{code: ws.CloseGoingAway, reason: "server is shutting down"}
+	errSessionOff     = &closeError{code: CloseSessionOff, reason: "session is off"}
+	errSlowClient     = &closeError{code: ws.CloseTryAgainLater, reason: "send queue is full"}
+)
+
+// closeError ends a connection with a close frame, so that the client knows why it was disconnected
+type closeError struct {
+	code   int
+	reason string
+}
+
+func (err *closeError) Error() string {
+	return fmt.Sprintf("%s (%d)", err.reason, err.code)
+}
+
+// writeClose sends the close frame of the error, if it is a closeError
+func writeClose(c *ws.Conn, err error, timeout time.Duration) {
+	var connCloseErr *closeError
+	if !errors.As(err, &connCloseErr) {
+		return
+	}
+	_ = c.WriteControl(ws.CloseMessage, ws.FormatCloseMessage(connCloseErr.code, connCloseErr.reason), time.Now().Add(timeout))
+}
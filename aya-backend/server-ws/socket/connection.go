@@ -0,0 +1,178 @@
+package socket
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	SEND_QUEUE_SIZE_ENV   = "SEND_QUEUE_SIZE"
+	SEND_QUEUE_POLICY_ENV = "SEND_QUEUE_POLICY"
+	WRITE_TIMEOUT_ENV     = "WRITE_TIMEOUT"
+	PING_INTERVAL_ENV     = "PING_INTERVAL"
+	PONG_TIMEOUT_ENV      = "PONG_TIMEOUT"
+
+	DEFAULT_SEND_QUEUE_SIZE = 64
+	DEFAULT_WRITE_TIMEOUT   = 10 * time.Second
+	DEFAULT_PING_INTERVAL   = 30 * time.Second
+	DEFAULT_PONG_TIMEOUT    = 60 * time.Second
+)
+
+// OverflowPolicy decides what happens when the send queue of a connection is full
+type OverflowPolicy string
+
+const (
+	// DropOldest drops the oldest queued message to make room for the new one
+	DropOldest OverflowPolicy = "drop_oldest"
+	// Disconnect closes the connection of the slow client, which can reconnect later
+	Disconnect OverflowPolicy = "disconnect"
+)
+
+type QueueConfig struct {
+	// Size is the number of messages queued per connection
+	Size   int
+	Policy OverflowPolicy
+	// WriteTimeout is how long writing a message to a connection can take
+	WriteTimeout time.Duration
+}
+
+func getQueueConfig() QueueConfig {
+	config := QueueConfig{
+		Size:         DEFAULT_SEND_QUEUE_SIZE,
+		Policy:       DropOldest,
+		WriteTimeout: DEFAULT_WRITE_TIMEOUT,
+	}
+
+	if sizeStr := os.Getenv(SEND_QUEUE_SIZE_ENV); sizeStr != "" {
+		size, err := strconv.Atoi(sizeStr)
+		if err != nil || size <= 0 {
+			fmt.Printf("Invalid %s value \"%s\", using default (%d)\n", SEND_QUEUE_SIZE_ENV, sizeStr, DEFAULT_SEND_QUEUE_SIZE)
+		} else {
+			config.Size = size
+		}
+	}
+
+	if policyStr := os.Getenv(SEND_QUEUE_POLICY_ENV); policyStr != "" {
+		switch policy := OverflowPolicy(policyStr); policy {
+		case DropOldest, Disconnect:
+			config.Policy = policy
+		default:
+			fmt.Printf("Invalid %s value \"%s\", using default (%s)\n", SEND_QUEUE_POLICY_ENV, policyStr, DropOldest)
+		}
+	}
+
+	if timeoutStr := os.Getenv(WRITE_TIMEOUT_ENV); timeoutStr != "" {
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil || timeout <= 0 {
+			fmt.Printf("Invalid %s value \"%s\", using default (%s)\n", WRITE_TIMEOUT_ENV, timeoutStr, DEFAULT_WRITE_TIMEOUT)
+		} else {
+			config.WriteTimeout = timeout
+		}
+	}
+
+	return config
+}
+
+// KeepaliveConfig sets how the dead websocket peers are detected. A ping is sent every
+// PingInterval, and the connection is closed when nothing, pongs included, is read for PongTimeout.
+type KeepaliveConfig struct {
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+}
+
+func getKeepaliveConfig() KeepaliveConfig {
+	config := KeepaliveConfig{
+		PingInterval: DEFAULT_PING_INTERVAL,
+		PongTimeout:  DEFAULT_PONG_TIMEOUT,
+	}
+
+	if intervalStr := os.Getenv(PING_INTERVAL_ENV); intervalStr != "" {
+		interval, err := time.ParseDuration(intervalStr)
+		if err != nil || interval <= 0 {
+			fmt.Printf("Invalid %s value \"%s\", using default (%s)\n", PING_INTERVAL_ENV, intervalStr, DEFAULT_PING_INTERVAL)
+		} else {
+			config.PingInterval = interval
+		}
+	}
+
+	if timeoutStr := os.Getenv(PONG_TIMEOUT_ENV); timeoutStr != "" {
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil || timeout <= 0 {
+			fmt.Printf("Invalid %s value \"%s\", using default (%s)\n", PONG_TIMEOUT_ENV, timeoutStr, DEFAULT_PONG_TIMEOUT)
+		} else {
+			config.PongTimeout = timeout
+		}
+	}
+
+	if config.PongTimeout <= config.PingInterval {
+		fmt.Printf("%s (%s) must be longer than %s (%s), using %s\n", PONG_TIMEOUT_ENV, config.PongTimeout, PING_INTERVAL_ENV, config.PingInterval, 2*config.PingInterval)
+		config.PongTimeout = 2 * config.PingInterval
+	}
+
+	return config
+}
+
+// wsConnection is the send queue of a connection to the stream of a session, a websocket
+// or an event stream. Messages are queued without blocking, so that a slow client does
+// not hold up the other sessions.
+type wsConnection struct {
+	queue chan sequencedUpdate
+	// client the updates are encoded for
+	client *streamClient
+	// evicted is closed when the connection has to be disconnected, evictErr tells why
+	evicted   chan struct{}
+	evictErr  error
+	evictOnce sync.Once
+}
+
+func newWSConnection(size int, client *streamClient) *wsConnection {
+	return &wsConnection{
+		queue:   make(chan sequencedUpdate, size),
+		client:  client,
+		evicted: make(chan struct{}),
+	}
+}
+
+func (conn *wsConnection) evict(err error) {
+	conn.evictOnce.Do(func() {
+		conn.evictErr = err
+		close(conn.evicted)
+	})
+}
+
+// evictionError returns why the connection was evicted, once evicted is closed
+func (conn *wsConnection) evictionError() error {
+	<-conn.evicted
+	return conn.evictErr
+}
+
+// enqueue queues the message following the overflow policy, and returns the number of dropped messages
+func (conn *wsConnection) enqueue(msg sequencedUpdate, policy OverflowPolicy) int {
+	select {
+	case conn.queue <- msg:
+		return 0
+	default:
+	}
+
+	if policy == Disconnect {
+		conn.evict(errSlowClient)
+		return 1
+	}
+
+	dropped := 0
+	for {
+		select {
+		case conn.queue <- msg:
+			return dropped
+		default:
+		}
+		select {
+		case <-conn.queue:
+			dropped++
+		default:
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package socket
+
+import (
+	. "aya-backend/server-ws/chat_service"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Commands the clients can send on the stream socket. A client starts the control
+// protocol with a hello, after which every frame sent by the server has a type.
+const (
+	HelloCommand       = "hello"
+	SubscribeCommand   = "subscribe"
+	UnsubscribeCommand = "unsubscribe"
+	HistoryCommand     = "history"
+	PingCommand        = "ping"
+)
+
+// Types of the frames sent by the server once the control protocol is started
+const (
+	WelcomeFrame = "welcome"
+	AckFrame     = "ack"
+	HistoryFrame = "history"
+	PongFrame    = "pong"
+	UpdateFrame  = "update"
+	ErrorFrame   = "error"
+	// GapFrame is sent, whether the control protocol is started or not, to the clients
+	// resuming from an update that is not kept anymore
+	GapFrame = "gap"
+	// SyncFrame is sent after the history replayed to the clients that can resume, with
+	// the sequence number to resume from
+	SyncFrame = "sync"
+)
+
+// Codes of the error frames
+const (
+	InvalidFrameError    = "invalid_frame"
+	UnknownCommandError  = "unknown_command"
+	HelloRequiredError   = "hello_required"
+	InvalidArgumentError = "invalid_argument"
+)
+
+var (
+	// capabilities of the server, the welcome frame lists those the client supports too
+	serverCapabilities = []string{SubscribeCommand, UnsubscribeCommand, HistoryCommand, PingCommand}
+)
+
+// ClientFrame is a command sent by a client. Id is sent back in the response to the command.
+type ClientFrame struct {
+	Type string `json:"type"`
+	Id   string `json:"id,omitempty"`
+	// Version is the protocol version the client wants to use, sent with hello
+	Version      ProtocolVersion `json:"version,omitempty"`
+	Capabilities []string        `json:"capabilities,omitempty"`
+	// Sources to (un)subscribe to
+	Sources []Source `json:"sources,omitempty"`
+	// Depth is the number of messages of the history to send back
+	Depth *int `json:"depth,omitempty"`
+}
+
+type frameHeader struct {
+	Type string `json:"type"`
+	Id   string `json:"id,omitempty"`
+}
+
+type WelcomeResponse struct {
+	frameHeader
+	Version      ProtocolVersion `json:"version"`
+	Capabilities []string        `json:"capabilities"`
+	Sources      []Source        `json:"sources"`
+}
+
+type AckResponse struct {
+	frameHeader
+	Command string   `json:"command"`
+	Sources []Source `json:"sources"`
+}
+
+type HistoryResponse struct {
+	frameHeader
+	Messages []any `json:"messages"`
+}
+
+type PongResponse struct {
+	frameHeader
+	Time time.Time `json:"time"`
+}
+
+type UpdateResponse struct {
+	frameHeader
+	Update any `json:"update"`
+}
+
+// GapResponse tells a resuming client that the updates following After are lost. The
+// history of the session is sent instead, up to the update Seq.
+type GapResponse struct {
+	frameHeader
+	After uint64 `json:"after"`
+	Seq   uint64 `json:"seq"`
+}
+
+type SyncResponse struct {
+	frameHeader
+	Seq uint64 `json:"seq"`
+}
+
+type ErrorResponse struct {
+	frameHeader
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func newErrorResponse(id string, code string, message string) ErrorResponse {
+	return ErrorResponse{
+		frameHeader: frameHeader{Type: ErrorFrame, Id: id},
+		Code:        code,
+		Message:     message,
+	}
+}
+
+// streamClient is the state of the control protocol of a connection
+type streamClient struct {
+	mutex sync.RWMutex
+	// encoding is negotiated when the connection opens, it does not change afterward
+	encoding        Encoding
+	protocolVersion ProtocolVersion
+	controlMode     bool
+	capabilities    []string
+	// sources the client subscribes to, every source until the client unsubscribes from one
+	sources map[Source]bool
+}
+
+func newStreamClient(protocolVersion ProtocolVersion, encoding Encoding, sources []Source) *streamClient {
+	client := streamClient{
+		encoding:        encoding,
+		protocolVersion: protocolVersion,
+		sources:         make(map[Source]bool),
+	}
+	for _, source := range sources {
+		client.sources[source] = true
+	}
+	return &client
+}
+
+// subscribedSources must be called with the mutex held
+func (client *streamClient) subscribedSources() []Source {
+	sources := make([]Source, 0, len(client.sources))
+	for source, subscribed := range client.sources {
+		if subscribed {
+			sources = append(sources, source)
+		}
+	}
+	slices.Sort(sources)
+	return sources
+}
+
+func (client *streamClient) isSubscribed(source Source) bool {
+	client.mutex.RLock()
+	defer client.mutex.RUnlock()
+	subscribed, ok := client.sources[source]
+	return !ok || subscribed
+}
+
+func (client *streamClient) version() ProtocolVersion {
+	client.mutex.RLock()
+	defer client.mutex.RUnlock()
+	return client.protocolVersion
+}
+
+// frameKey returns the key of the update frames sent to the client
+func (client *streamClient) frameKey() frameKey {
+	client.mutex.RLock()
+	defer client.mutex.RUnlock()
+	return frameKey{
+		encoding:    client.encoding,
+		version:     client.protocolVersion,
+		controlMode: client.controlMode,
+	}
+}
+
+// updateFrame returns the frame of the update for the clients of the key
+func updateFrame(msg MessageUpdate, key frameKey) any {
+	var frame any = msg.ForProtocol(key.version)
+	if key.controlMode {
+		frame = UpdateResponse{
+			frameHeader: frameHeader{Type: UpdateFrame},
+			Update:      frame,
+		}
+	}
+	return frame
+}
+
+// encodeUpdate returns the frame of the update, or false if the client does not subscribe to its source
+func (client *streamClient) encodeUpdate(update sequencedUpdate) (*encodedFrame, bool, error) {
+	if !client.isSubscribed(update.update.Message.Source) {
+		return nil, false, nil
+	}
+	frame, err := update.frames.get(client.frameKey())
+	return frame, true, err
+}
+
+func (client *streamClient) hello(frame ClientFrame) any {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if frame.Version != 0 {
+		if frame.Version < ProtocolV1 {
+			return newErrorResponse(frame.Id, InvalidArgumentError, fmt.Sprintf("unsupported protocol version %d", frame.Version))
+		}
+		client.protocolVersion = min(frame.Version, LatestProtocolVersion)
+	}
+	client.controlMode = true
+	client.capabilities = []string{}
+	for _, capability := range frame.Capabilities {
+		if slices.Contains(serverCapabilities, capability) {
+			client.capabilities = append(client.capabilities, capability)
+		}
+	}
+	return WelcomeResponse{
+		frameHeader:  frameHeader{Type: WelcomeFrame, Id: frame.Id},
+		Version:      client.protocolVersion,
+		Capabilities: client.capabilities,
+		Sources:      client.subscribedSources(),
+	}
+}
+
+func (client *streamClient) subscribe(frame ClientFrame, subscribed bool) any {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if len(frame.Sources) == 0 {
+		return newErrorResponse(frame.Id, InvalidArgumentError, "sources are required")
+	}
+	for _, source := range frame.Sources {
+		if _, ok := client.sources[source]; !ok {
+			return newErrorResponse(frame.Id, InvalidArgumentError, fmt.Sprintf("source %s is not enabled", source))
+		}
+	}
+	for _, source := range frame.Sources {
+		client.sources[source] = subscribed
+	}
+	return AckResponse{
+		frameHeader: frameHeader{Type: AckFrame, Id: frame.Id},
+		Command:     frame.Type,
+		Sources:     client.subscribedSources(),
+	}
+}
+
+// handleCommand runs the command sent by the client and returns the frame to send back
+func (server *WSServer) handleCommand(sessionId string, client *streamClient, messageType int, data []byte) any {
+	var frame ClientFrame
+	if err := client.encoding.unmarshal(messageType, data, &frame); err != nil {
+		return newErrorResponse("", InvalidFrameError, err.Error())
+	}
+
+	client.mutex.RLock()
+	controlMode := client.controlMode
+	client.mutex.RUnlock()
+	if !controlMode && frame.Type != HelloCommand {
+		return newErrorResponse(frame.Id, HelloRequiredError, "send a hello command first")
+	}
+
+	switch frame.Type {
+	case HelloCommand:
+		return client.hello(frame)
+	case SubscribeCommand:
+		return client.subscribe(frame, true)
+	case UnsubscribeCommand:
+		return client.subscribe(frame, false)
+	case HistoryCommand:
+		depth := server.historyConfig.MaxMessages
+		if frame.Depth != nil {
+			if *frame.Depth < 0 {
+				return newErrorResponse(frame.Id, InvalidArgumentError, fmt.Sprintf("invalid history depth %d", *frame.Depth))
+			}
+			depth = min(*frame.Depth, server.historyConfig.MaxMessages)
+		}
+		version := client.version()
+		messages := []any{}
+		for _, msg := range server.historySnapshot(sessionId, depth) {
+			if client.isSubscribed(msg.Message.Source) {
+				messages = append(messages, msg.ForProtocol(version))
+			}
+		}
+		return HistoryResponse{
+			frameHeader: frameHeader{Type: HistoryFrame, Id: frame.Id},
+			Messages:    messages,
+		}
+	case PingCommand:
+		return PongResponse{
+			frameHeader: frameHeader{Type: PongFrame, Id: frame.Id},
+			Time:        time.Now(),
+		}
+	default:
+		return newErrorResponse(frame.Id, UnknownCommandError, fmt.Sprintf("unknown command \"%s\"", frame.Type))
+	}
+}
@@ -0,0 +1,186 @@
+package socket
+
+import (
+	. "aya-backend/server-ws/chat_service"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/fxamacker/cbor/v2"
+	ws "github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WS_COMPRESSION_ENV enables permessage-deflate for the clients that support it
+const WS_COMPRESSION_ENV = "WS_COMPRESSION"
+
+// Encoding is the format of the frames of a websocket, negotiated through Sec-WebSocket-Protocol
+type Encoding string
+
+const (
+	// JSONEncoding sends text frames, it is used when the client does not ask for an encoding
+	JSONEncoding    Encoding = "aya.json"
+	MsgpackEncoding Encoding = "aya.msgpack"
+	CBOREncoding    Encoding = "aya.cbor"
+)
+
+var (
+	supportedEncodings = []Encoding{JSONEncoding, MsgpackEncoding, CBOREncoding}
+
+	cborEncMode, _ = cbor.EncOptions{
+		// the times and the updates are sent as text, like in the JSON frames
+		Time:          cbor.TimeRFC3339Nano,
+		TextMarshaler: cbor.TextMarshalerTextString,
+	}.EncMode()
+	cborDecMode, _ = cbor.DecOptions{
+		// decode the maps as JSON objects, so that they can be turned into JSON
+		DefaultMapType: reflect.TypeOf(map[string]any{}),
+	}.DecMode()
+)
+
+// negotiateEncoding returns the first encoding requested by the client that the server supports.
+// It returns false if the client did not request any, or none is supported.
+func negotiateEncoding(r *http.Request) (Encoding, bool) {
+	for _, protocol := range ws.Subprotocols(r) {
+		for _, encoding := range supportedEncodings {
+			if Encoding(protocol) == encoding {
+				return encoding, true
+			}
+		}
+	}
+	return JSONEncoding, false
+}
+
+func init() {
+	// msgpack sends the times as timestamp extensions and the text of the updates as
+	// binary, they are sent as strings like in the JSON frames
+	msgpack.Register(time.Time{}, func(encoder *msgpack.Encoder, value reflect.Value) error {
+		return encoder.EncodeString(value.Interface().(time.Time).Format(time.RFC3339Nano))
+	}, nil)
+	msgpack.Register(Update(0), func(encoder *msgpack.Encoder, value reflect.Value) error {
+		return encoder.EncodeString(value.Interface().(Update).String())
+	}, nil)
+}
+
+func getCompressionEnabled() bool {
+	compressionStr := os.Getenv(WS_COMPRESSION_ENV)
+	if compressionStr == "" {
+		return false
+	}
+	compression, err := strconv.ParseBool(compressionStr)
+	if err != nil {
+		fmt.Printf("Invalid %s value \"%s\", compression is disabled\n", WS_COMPRESSION_ENV, compressionStr)
+		return false
+	}
+	if compression {
+		fmt.Println("Websocket compression enabled")
+	}
+	return compression
+}
+
+func (encoding Encoding) messageType() int {
+	if encoding == JSONEncoding {
+		return ws.TextMessage
+	}
+	return ws.BinaryMessage
+}
+
+// marshal encodes a frame sent by the server. The binary encodings read the json tags of
+// the frames, so that the frames have the same fields whatever their encoding.
+func (encoding Encoding) marshal(value any) ([]byte, error) {
+	switch encoding {
+	case JSONEncoding:
+		return json.Marshal(value)
+	case MsgpackEncoding:
+		var buffer bytes.Buffer
+		encoder := msgpack.NewEncoder(&buffer)
+		encoder.SetCustomStructTag("json")
+		encoder.UseCompactInts(true)
+		if err := encoder.Encode(value); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	case CBOREncoding:
+		return cborEncMode.Marshal(value)
+	default:
+		return nil, fmt.Errorf("unknown encoding %s", encoding)
+	}
+}
+
+// unmarshal decodes a frame sent by the client. Text frames are always JSON.
+func (encoding Encoding) unmarshal(messageType int, data []byte, value any) error {
+	if messageType == ws.TextMessage || encoding == JSONEncoding {
+		return json.Unmarshal(data, value)
+	}
+	var decoded any
+	var err error
+	switch encoding {
+	case MsgpackEncoding:
+		err = msgpack.Unmarshal(data, &decoded)
+	case CBOREncoding:
+		err = cborDecMode.Unmarshal(data, &decoded)
+	default:
+		err = fmt.Errorf("unknown encoding %s", encoding)
+	}
+	if err != nil {
+		return err
+	}
+	jsonData, err := json.Marshal(decoded)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonData, value)
+}
+
+// frameKey identifies the frames of an update that are the same for every client
+type frameKey struct {
+	encoding    Encoding
+	version     ProtocolVersion
+	controlMode bool
+}
+
+type encodedFrame struct {
+	data []byte
+	// prepared caches the frame as written on the websockets, compressed or not
+	prepared *ws.PreparedMessage
+}
+
+// frameCache encodes the frames of an update once, however many clients it is sent to
+type frameCache struct {
+	mutex  sync.Mutex
+	frames map[frameKey]*encodedFrame
+	// build returns the value to marshal for the frame
+	build func(key frameKey) any
+}
+
+func newFrameCache(build func(key frameKey) any) *frameCache {
+	return &frameCache{
+		frames: make(map[frameKey]*encodedFrame),
+		build:  build,
+	}
+}
+
+func (cache *frameCache) get(key frameKey) (*encodedFrame, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if frame, ok := cache.frames[key]; ok {
+		return frame, nil
+	}
+
+	data, err := key.encoding.marshal(cache.build(key))
+	if err != nil {
+		return nil, err
+	}
+	prepared, err := ws.NewPreparedMessage(key.encoding.messageType(), data)
+	if err != nil {
+		return nil, err
+	}
+	frame := &encodedFrame{data: data, prepared: prepared}
+	cache.frames[key] = frame
+	return frame, nil
+}
@@ -0,0 +1,130 @@
+package socket
+
+import (
+	. "aya-backend/server-ws/chat_service"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func testMessageUpdate() MessageUpdate {
+	return MessageUpdate{
+		UpdateTime: time.Date(2026, 1, 2, 3, 4, 5, 123456789, time.UTC),
+		Update:     Reaction,
+		Seq:        42,
+		Message: Message{
+			Source: Source("discord"),
+			Id:     "m1",
+			Author: Author{Id: "u1", Username: "alice", Color: "#ffffff", Badges: []Badge{{Name: "vip"}}},
+			MessageParts: []MessagePart{
+				{Content: "hi", Format: &Format{Bold: true}},
+				{Emoji: &Emoji{Id: "https://example.com/e.png", Alt: ":e:"}},
+			},
+			Attachments: []Attachment{{Url: "https://example.com/a.png", Filename: "a.png", Width: 10}},
+			Event:       &MessageEvent{Type: "superChatEvent", AmountMicros: 5000000},
+			ReplyTo:     &ReplyTo{Id: "m0"},
+			Reactions:   []MessageReaction{{Emoji: Emoji{Alt: "x"}, Count: 3}},
+		},
+		Reaction:    &ReactionChange{Emoji: Emoji{Alt: "x"}, User: Author{Username: "bob"}, Added: true},
+		ExtraFields: "not sent",
+	}
+}
+
+// decodeFrame decodes a frame of the encoding into generic maps, then through JSON so that
+// the numbers of every encoding compare equal
+func decodeFrame(t *testing.T, encoding Encoding, data []byte) any {
+	t.Helper()
+	var decoded any
+	var err error
+	switch encoding {
+	case JSONEncoding:
+		err = json.Unmarshal(data, &decoded)
+	case MsgpackEncoding:
+		err = msgpack.Unmarshal(data, &decoded)
+	case CBOREncoding:
+		err = cborDecMode.Unmarshal(data, &decoded)
+	}
+	if err != nil {
+		t.Fatalf("cannot decode the %s frame: %s", encoding, err.Error())
+	}
+	jsonData, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatalf("cannot convert the %s frame: %s", encoding, err.Error())
+	}
+	var value any
+	if err := json.Unmarshal(jsonData, &value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestEncodingsMatchJSON(t *testing.T) {
+	msg := testMessageUpdate()
+	frames := []struct {
+		name  string
+		value any
+	}{
+		{name: "update v1", value: updateFrame(msg, frameKey{version: ProtocolV1})},
+		{name: "update v2", value: updateFrame(msg, frameKey{version: ProtocolV2})},
+		{name: "control update v1", value: updateFrame(msg, frameKey{version: ProtocolV1, controlMode: true})},
+		{name: "history", value: HistoryResponse{frameHeader: frameHeader{Type: HistoryFrame, Id: "1"}, Messages: []any{msg.ForProtocol(ProtocolV2)}}},
+		{name: "pong", value: PongResponse{frameHeader: frameHeader{Type: PongFrame}, Time: msg.UpdateTime}},
+		{name: "gap", value: GapResponse{frameHeader: frameHeader{Type: GapFrame}, After: 3, Seq: 9}},
+	}
+	for _, frame := range frames {
+		t.Run(frame.name, func(t *testing.T) {
+			jsonData, err := JSONEncoding.marshal(frame.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := decodeFrame(t, JSONEncoding, jsonData)
+			for _, encoding := range []Encoding{MsgpackEncoding, CBOREncoding} {
+				data, err := encoding.marshal(frame.value)
+				if err != nil {
+					t.Fatalf("cannot encode the %s frame: %s", encoding, err.Error())
+				}
+				if got := decodeFrame(t, encoding, data); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s frame = %v, want %v", encoding, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodedUpdateFields(t *testing.T) {
+	msg := testMessageUpdate()
+	for _, encoding := range supportedEncodings {
+		t.Run(string(encoding), func(t *testing.T) {
+			data, err := encoding.marshal(updateFrame(msg, frameKey{version: ProtocolV1}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			frame, ok := decodeFrame(t, encoding, data).(map[string]any)
+			if !ok {
+				t.Fatalf("%s frame is not a map", encoding)
+			}
+			for _, field := range []string{"updateTime", "update", "message", "reaction", "seq"} {
+				if _, ok := frame[field]; !ok {
+					t.Errorf("%s frame has no %s field", encoding, field)
+				}
+			}
+			if _, ok := frame["ExtraFields"]; ok {
+				t.Errorf("%s frame has the extra fields", encoding)
+			}
+			if frame["update"] != "reaction" || frame["updateTime"] != "2026-01-02T03:04:05.123456789Z" {
+				t.Errorf("%s frame update = %v at %v", encoding, frame["update"], frame["updateTime"])
+			}
+			// the legacy attachments shadow those of the message
+			message := frame["message"].(map[string]any)
+			if attachments, _ := message["attachments"].([]any); len(attachments) != 1 || attachments[0] != "a.png" {
+				t.Errorf("%s frame attachments = %v, want [a.png]", encoding, message["attachments"])
+			}
+			if _, ok := message["Message"]; ok {
+				t.Errorf("%s frame nests the embedded message", encoding)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package socket
+
+import (
+	. "aya-backend/server-ws/chat_service"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	HISTORY_MAX_MESSAGES_ENV = "HISTORY_MAX_MESSAGES"
+	HISTORY_MAX_UPDATES_ENV  = "HISTORY_MAX_UPDATES"
+	HISTORY_MAX_AGE_ENV      = "HISTORY_MAX_AGE"
+
+	DEFAULT_HISTORY_MAX_MESSAGES = 50
+	DEFAULT_HISTORY_MAX_UPDATES  = 200
+	DEFAULT_HISTORY_MAX_AGE      = 30 * time.Minute
+)
+
+type HistoryConfig struct {
+	// MaxMessages is the maximum number of messages kept per session
+	MaxMessages int
+	// MaxUpdates is the maximum number of updates kept per session to resume the streams
+	MaxUpdates int
+	// MaxAge is how long a message is kept in the history
+	MaxAge time.Duration
+}
+
+func getHistoryConfig() HistoryConfig {
+	config := HistoryConfig{
+		MaxMessages: DEFAULT_HISTORY_MAX_MESSAGES,
+		MaxUpdates:  DEFAULT_HISTORY_MAX_UPDATES,
+		MaxAge:      DEFAULT_HISTORY_MAX_AGE,
+	}
+
+	if maxMessagesStr := os.Getenv(HISTORY_MAX_MESSAGES_ENV); maxMessagesStr != "" {
+		maxMessages, err := strconv.Atoi(maxMessagesStr)
+		if err != nil || maxMessages < 0 {
+			fmt.Printf("Invalid %s value \"%s\", using default (%d)\n", HISTORY_MAX_MESSAGES_ENV, maxMessagesStr, DEFAULT_HISTORY_MAX_MESSAGES)
+		} else {
+			config.MaxMessages = maxMessages
+		}
+	}
+
+	if maxUpdatesStr := os.Getenv(HISTORY_MAX_UPDATES_ENV); maxUpdatesStr != "" {
+		maxUpdates, err := strconv.Atoi(maxUpdatesStr)
+		if err != nil || maxUpdates < 0 {
+			fmt.Printf("Invalid %s value \"%s\", using default (%d)\n", HISTORY_MAX_UPDATES_ENV, maxUpdatesStr, DEFAULT_HISTORY_MAX_UPDATES)
+		} else {
+			config.MaxUpdates = maxUpdates
+		}
+	}
+
+	if maxAgeStr := os.Getenv(HISTORY_MAX_AGE_ENV); maxAgeStr != "" {
+		maxAge, err := time.ParseDuration(maxAgeStr)
+		if err != nil || maxAge < 0 {
+			fmt.Printf("Invalid %s value \"%s\", using default (%s)\n", HISTORY_MAX_AGE_ENV, maxAgeStr, DEFAULT_HISTORY_MAX_AGE)
+		} else {
+			config.MaxAge = maxAge
+		}
+	}
+
+	return config
+}
+
+// sequencedUpdate is an update with its sequence number within the session
+type sequencedUpdate struct {
+	seq    uint64
+	update MessageUpdate
+	// frames are shared by the connections the update is sent to
+	frames *frameCache
+}
+
+// newSequencedUpdate numbers the update. The history keeps the number in the messages,
+// so that they are replayed with it.
+func newSequencedUpdate(seq uint64, msg MessageUpdate) sequencedUpdate {
+	msg.Seq = seq
+	return sequencedUpdate{
+		seq:    seq,
+		update: msg,
+		frames: newFrameCache(func(key frameKey) any {
+			return updateFrame(msg, key)
+		}),
+	}
+}
+
+// sessionHistory keeps the most recent messages of a session, with later
+// edits and deletions applied, so that they can be replayed to new connections.
+// It also keeps the most recent updates as they were sent, so that the streams
+// can resume from the sequence number of the last update they received.
+type sessionHistory struct {
+	mutex    sync.Mutex
+	config   HistoryConfig
+	messages []MessageUpdate
+	updates  []sequencedUpdate
+	lastSeq  uint64
+	// initialized is set by the first update, lastSeq is meaningless before it
+	initialized bool
+	// changed is closed when an update is added, to wake up the long polls
+	changed chan struct{}
+}
+
+func newSessionHistory(config HistoryConfig) *sessionHistory {
+	return &sessionHistory{
+		config:   config,
+		messages: []MessageUpdate{},
+		updates:  []sequencedUpdate{},
+		changed:  make(chan struct{}),
+	}
+}
+
+func (history *sessionHistory) indexOf(msg Message) int {
+	for i := range history.messages {
+		if history.messages[i].Message.Source == msg.Source && history.messages[i].Message.Id == msg.Id {
+			return i
+		}
+	}
+	return -1
+}
+
+// prune removes messages that are too old or exceed the maximum count.
+// Must be called with the mutex held.
+func (history *sessionHistory) prune() {
+	if history.config.MaxAge > 0 {
+		cutoff := time.Now().Add(-history.config.MaxAge)
+		idx := 0
+		for idx < len(history.messages) && history.messages[idx].UpdateTime.Before(cutoff) {
+			idx++
+		}
+		history.messages = history.messages[idx:]
+	}
+	if len(history.messages) > history.config.MaxMessages {
+		history.messages = history.messages[len(history.messages)-history.config.MaxMessages:]
+	}
+
+	if history.config.MaxAge > 0 {
+		cutoff := time.Now().Add(-history.config.MaxAge)
+		idx := 0
+		for idx < len(history.updates) && history.updates[idx].update.UpdateTime.Before(cutoff) {
+			idx++
+		}
+		history.updates = history.updates[idx:]
+	}
+	if len(history.updates) > history.config.MaxUpdates {
+		history.updates = history.updates[len(history.updates)-history.config.MaxUpdates:]
+	}
+}
+
+// add applies the update, numbered by the dispatch, to the history. It returns false if the
+// sequence number of the update does not follow the previous ones, in which case it is ignored.
+func (history *sessionHistory) add(update sequencedUpdate) bool {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+
+	if update.seq == 0 || (history.initialized && update.seq <= history.lastSeq) {
+		return false
+	}
+	history.initialized = true
+	history.lastSeq = update.seq
+	history.updates = append(history.updates, update)
+	close(history.changed)
+	history.changed = make(chan struct{})
+	history.apply(update.update)
+	history.prune()
+	return true
+}
+
+// apply applies the update to the messages. Must be called with the mutex held.
+func (history *sessionHistory) apply(msg MessageUpdate) {
+	switch msg.Update {
+	case New:
+		if idx := history.indexOf(msg.Message); idx != -1 {
+			// the same message is sent twice, keep the latest version of it
+			history.messages[idx].Message = msg.Message
+		} else {
+			history.messages = append(history.messages, msg)
+		}
+	case Edit:
+		idx := history.indexOf(msg.Message)
+		if idx == -1 {
+			return
+		}
+		history.messages[idx].Message.MessageParts = msg.Message.MessageParts
+		history.messages[idx].Message.Attachments = msg.Message.Attachments
+		if msg.Message.Author.Username != "" {
+			history.messages[idx].Message.Author = msg.Message.Author
+		}
+	case Delete:
+		idx := history.indexOf(msg.Message)
+		if idx == -1 {
+			return
+		}
+		history.messages = append(history.messages[:idx], history.messages[idx+1:]...)
+	case Reaction:
+		idx := history.indexOf(msg.Message)
+		if idx == -1 {
+			return
+		}
+		history.messages[idx].Message.Reactions = msg.Message.Reactions
+	case Clear:
+		resourceKey, err := GetResourceKey(msg.Message.Source, msg.ExtraFields)
+		if err != nil {
+			fmt.Printf("Cannot clear the history: %s\n", err.Error())
+			return
+		}
+		history.messages = slices.DeleteFunc(history.messages, func(storedMsg MessageUpdate) bool {
+			if storedMsg.Message.Source != msg.Message.Source {
+				return false
+			}
+			storedResourceKey, err := GetResourceKey(storedMsg.Message.Source, storedMsg.ExtraFields)
+			return err == nil && storedResourceKey == resourceKey
+		})
+	default:
+	}
+}
+
+// snapshot returns up to depth of the most recent messages, oldest first.
+func (history *sessionHistory) snapshot(depth int) []MessageUpdate {
+	messages, _ := history.sequencedSnapshot(depth)
+	return messages
+}
+
+// sequencedSnapshot returns the snapshot along with the sequence number of the last update applied to it
+func (history *sessionHistory) sequencedSnapshot(depth int) ([]MessageUpdate, uint64) {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+
+	history.prune()
+
+	if depth <= 0 {
+		return []MessageUpdate{}, history.lastSeq
+	}
+	start := len(history.messages) - depth
+	if start < 0 {
+		start = 0
+	}
+	messages := make([]MessageUpdate, len(history.messages)-start)
+	copy(messages, history.messages[start:])
+	return messages, history.lastSeq
+}
+
+// sequence returns the sequence number of the last update
+func (history *sessionHistory) sequence() uint64 {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+	return history.lastSeq
+}
+
+// updatesAfter returns the updates following the sequence number, oldest first.
+// It returns false if some of them are not kept anymore, or if the sequence number
+// is unknown, e.g. because it was sent before the server restarted. 0 is never known,
+// it is the cursor of the clients that have not received anything yet.
+func (history *sessionHistory) updatesAfter(seq uint64) ([]sequencedUpdate, bool) {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+
+	history.prune()
+
+	if seq == 0 || !history.initialized || seq > history.lastSeq {
+		return nil, false
+	}
+	if len(history.updates) == 0 && seq < history.lastSeq {
+		return nil, false
+	}
+	if len(history.updates) > 0 && history.updates[0].seq > seq+1 {
+		return nil, false
+	}
+	updates := make([]sequencedUpdate, 0, history.lastSeq-seq)
+	for _, update := range history.updates {
+		if update.seq > seq {
+			updates = append(updates, update)
+		}
+	}
+	return updates, true
+}
+
+// waitChannel returns a channel that is closed when the next update is added
+func (history *sessionHistory) waitChannel() <-chan struct{} {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+	return history.changed
+}
@@ -0,0 +1,125 @@
+package socket
+
+import (
+	. "aya-backend/server-ws/chat_service"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestHistory returns a history keeping up to maxUpdates updates, filled with new messages numbered from 1 to lastSeq
+func newTestHistory(maxUpdates int, lastSeq uint64) *sessionHistory {
+	history := newSessionHistory(HistoryConfig{MaxMessages: 10, MaxUpdates: maxUpdates})
+	for seq := uint64(1); seq <= lastSeq; seq++ {
+		history.add(testUpdate(seq))
+	}
+	return history
+}
+
+func testUpdate(seq uint64) sequencedUpdate {
+	return newSequencedUpdate(seq, MessageUpdate{
+		UpdateTime: time.Now(),
+		Update:     New,
+		Message:    Message{Id: strconv.FormatUint(seq, 10)},
+	})
+}
+
+func updateSeqs(updates []sequencedUpdate) []uint64 {
+	seqs := []uint64{}
+	for _, update := range updates {
+		seqs = append(seqs, update.seq)
+	}
+	return seqs
+}
+
+func TestUpdatesAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxUpdates int
+		lastSeq    uint64
+		after      uint64
+		want       []uint64
+		ok         bool
+	}{
+		{name: "resume inside the buffer", maxUpdates: 5, lastSeq: 4, after: 2, want: []uint64{3, 4}, ok: true},
+		{name: "resume from the update before the buffer", maxUpdates: 3, lastSeq: 6, after: 3, want: []uint64{4, 5, 6}, ok: true},
+		{name: "resume from the last update", maxUpdates: 5, lastSeq: 4, after: 4, want: []uint64{}, ok: true},
+		{name: "resume past the pruned start", maxUpdates: 3, lastSeq: 6, after: 2, ok: false},
+		{name: "resume without kept updates", maxUpdates: 0, lastSeq: 6, after: 5, ok: false},
+		{name: "resume at the last update without kept updates", maxUpdates: 0, lastSeq: 6, after: 6, want: []uint64{}, ok: true},
+		{name: "after the last update, e.g. after a restart", maxUpdates: 5, lastSeq: 4, after: 9, ok: false},
+		{name: "no cursor", maxUpdates: 5, lastSeq: 4, after: 0, ok: false},
+		{name: "empty history", maxUpdates: 5, lastSeq: 0, after: 1, ok: false},
+		{name: "empty history without cursor", maxUpdates: 5, lastSeq: 0, after: 0, ok: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			history := newTestHistory(test.maxUpdates, test.lastSeq)
+			updates, ok := history.updatesAfter(test.after)
+			if ok != test.ok {
+				t.Fatalf("updatesAfter(%d) ok = %t, want %t", test.after, ok, test.ok)
+			}
+			if ok && !slices.Equal(updateSeqs(updates), test.want) {
+				t.Errorf("updatesAfter(%d) = %v, want %v", test.after, updateSeqs(updates), test.want)
+			}
+		})
+	}
+}
+
+func TestAddSequence(t *testing.T) {
+	history := newTestHistory(5, 0)
+	if history.add(testUpdate(0)) {
+		t.Error("update 0 was added")
+	}
+	if !history.add(testUpdate(3)) {
+		t.Fatal("first update was not added")
+	}
+	if history.add(testUpdate(3)) || history.add(testUpdate(2)) {
+		t.Error("update out of sequence was added")
+	}
+	if !history.add(testUpdate(4)) {
+		t.Error("following update was not added")
+	}
+	if seq := history.sequence(); seq != 4 {
+		t.Errorf("sequence() = %d, want 4", seq)
+	}
+
+	// the history starts at the first update it got, the updates before it are unknown
+	if _, ok := history.updatesAfter(1); ok {
+		t.Error("updatesAfter(1) is ok before the first update")
+	}
+	updates, ok := history.updatesAfter(2)
+	if !ok || !slices.Equal(updateSeqs(updates), []uint64{3, 4}) {
+		t.Errorf("updatesAfter(2) = %v, %t, want [3 4], true", updateSeqs(updates), ok)
+	}
+}
+
+func TestEmptySnapshot(t *testing.T) {
+	history := newTestHistory(5, 0)
+	messages, seq := history.sequencedSnapshot(10)
+	if len(messages) != 0 || seq != 0 {
+		t.Errorf("sequencedSnapshot(10) = %d messages, %d, want 0 messages, 0", len(messages), seq)
+	}
+}
+
+func TestSnapshotKeepsSequence(t *testing.T) {
+	history := newTestHistory(5, 3)
+	history.add(newSequencedUpdate(4, MessageUpdate{
+		UpdateTime: time.Now(),
+		Update:     Edit,
+		Message:    Message{Id: "2", MessageParts: []MessagePart{{Content: "edited"}}},
+	}))
+	messages, seq := history.sequencedSnapshot(10)
+	if seq != 4 {
+		t.Errorf("snapshot sequence = %d, want 4", seq)
+	}
+	// the messages are replayed with the sequence number they were sent with
+	seqs := []uint64{}
+	for _, message := range messages {
+		seqs = append(seqs, message.Seq)
+	}
+	if !slices.Equal(seqs, []uint64{1, 2, 3}) {
+		t.Errorf("snapshot message sequences = %v, want [1 2 3]", seqs)
+	}
+}
@@ -0,0 +1,90 @@
+package socket
+
+import (
+	models "aya-backend/db-models"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	// ALLOWED_ORIGINS_ENV is the comma separated list of the origin patterns that can read the streams.
+	// WEBSITE_HOST_ORIGIN is added to it, but only when it is set, so that a deployment only setting
+	// the website keeps the overlays served from other origins. Patterns can start their host with
+	// a wildcard, e.g. https://*.example.com
+	ALLOWED_ORIGINS_ENV = "ALLOWED_ORIGINS"
+)
+
+type OriginConfig struct {
+	// AllowedOrigins are the origin patterns that can read the streams, every origin if empty
+	AllowedOrigins []string
+}
+
+func getOriginConfig() OriginConfig {
+	config := OriginConfig{}
+
+	for _, pattern := range strings.Split(os.Getenv(ALLOWED_ORIGINS_ENV), ",") {
+		config.addPattern(pattern)
+	}
+	if len(config.AllowedOrigins) == 0 {
+		fmt.Printf("%s environment variable not set, the streams can be read from every origin\n", ALLOWED_ORIGINS_ENV)
+		return config
+	}
+
+	config.addPattern(os.Getenv(WEBSITE_HOST_ORIGIN_ENV))
+	fmt.Printf("The streams can be read from %s\n", strings.Join(config.AllowedOrigins, ", "))
+	return config
+}
+
+func (config *OriginConfig) addPattern(pattern string) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return
+	}
+	if err := models.ValidateOriginPattern(pattern); err != nil {
+		fmt.Printf("Ignoring the allowed origin: %s\n", err.Error())
+		return
+	}
+	if !slices.Contains(config.AllowedOrigins, pattern) {
+		config.AllowedOrigins = append(config.AllowedOrigins, pattern)
+	}
+}
+
+func matchAnyOrigin(patterns []string, origin string) bool {
+	for _, pattern := range patterns {
+		if models.MatchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin checks that the origin of the request is allowed by the server and by the
+// session. Requests without an origin do not come from a browser page, and are let in.
+func (server *WSServer) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	sessionId := mux.Vars(r)["id"]
+
+	if len(server.originConfig.AllowedOrigins) > 0 && !matchAnyOrigin(server.originConfig.AllowedOrigins, origin) {
+		fmt.Printf("Rejected stream of session %s from origin %s, not allowed by the server\n", sessionId, origin)
+		return false
+	}
+
+	sessionOrigins, err := server.infoDB.GetAllowedOrigins(sessionId)
+	if err != nil {
+		// like the token revocation, a database hiccup does not turn the viewers away
+		fmt.Printf("Cannot read the allowed origins of session %s: %s\n", sessionId, err.Error())
+		return true
+	}
+	if len(sessionOrigins) > 0 && !matchAnyOrigin(sessionOrigins, origin) {
+		fmt.Printf("Rejected stream of session %s from origin %s, not allowed by the session\n", sessionId, origin)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package socket
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGetOriginConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		allowedOrigins string
+		websiteOrigin  string
+		want           []string
+	}{
+		{name: "nothing set", want: nil},
+		{name: "only the website", websiteOrigin: "https://aya.example.com", want: nil},
+		{
+			name:           "allowed origins",
+			allowedOrigins: "https://a.com, https://*.b.com",
+			want:           []string{"https://a.com", "https://*.b.com"},
+		},
+		{
+			name:           "allowed origins and the website",
+			allowedOrigins: "https://a.com",
+			websiteOrigin:  "https://aya.example.com",
+			want:           []string{"https://a.com", "https://aya.example.com"},
+		},
+		{
+			name:           "website already allowed",
+			allowedOrigins: "https://aya.example.com",
+			websiteOrigin:  "https://aya.example.com",
+			want:           []string{"https://aya.example.com"},
+		},
+		{
+			name:           "invalid patterns are skipped",
+			allowedOrigins: "https://a.com/path,,https://a.*.com",
+			websiteOrigin:  "https://aya.example.com",
+			want:           nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(ALLOWED_ORIGINS_ENV, test.allowedOrigins)
+			t.Setenv(WEBSITE_HOST_ORIGIN_ENV, test.websiteOrigin)
+			config := getOriginConfig()
+			if !slices.Equal(config.AllowedOrigins, test.want) {
+				t.Errorf("AllowedOrigins = %v, want %v", config.AllowedOrigins, test.want)
+			}
+		})
+	}
+}
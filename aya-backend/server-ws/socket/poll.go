@@ -0,0 +1,258 @@
+package socket
+
+import (
+	. "aya-backend/server-ws/chat_service"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	POLL_LINGER_ENV = "POLL_LINGER"
+
+	AFTER_QUERY = "after"
+	WAIT_QUERY  = "wait"
+
+	// DEFAULT_POLL_LINGER is how long a session stays registered after its last poll
+	DEFAULT_POLL_LINGER = 60 * time.Second
+	DEFAULT_POLL_WAIT   = 25 * time.Second
+	MAX_POLL_WAIT       = 55 * time.Second
+)
+
+type PollConfig struct {
+	// Linger is how long a session that only has pollers stays registered after the last poll
+	Linger time.Duration
+}
+
+func getPollConfig() PollConfig {
+	config := PollConfig{
+		Linger: DEFAULT_POLL_LINGER,
+	}
+
+	if lingerStr := os.Getenv(POLL_LINGER_ENV); lingerStr != "" {
+		linger, err := time.ParseDuration(lingerStr)
+		if err != nil || linger <= 0 {
+			fmt.Printf("Invalid %s value \"%s\", using default (%s)\n", POLL_LINGER_ENV, lingerStr, DEFAULT_POLL_LINGER)
+		} else {
+			config.Linger = linger
+		}
+	}
+
+	return config
+}
+
+// pollLease keeps a polled session registered until it expires
+type pollLease struct {
+	timer     *time.Timer
+	expiresAt time.Time
+}
+
+type PollUpdate struct {
+	// Seq is omitted for the messages of the history
+	Seq    uint64 `json:"seq,omitempty"`
+	Update any    `json:"update"`
+}
+
+type PollResponse struct {
+	Updates []PollUpdate `json:"updates"`
+	// Cursor is the sequence number to send as after in the next poll
+	Cursor uint64 `json:"cursor"`
+	// Reset is true when the updates are the history of the session instead of the updates
+	// following the cursor, which are not kept anymore
+	Reset bool `json:"reset"`
+}
+
+// touchPollLease registers the polled session, or extends its lease, and returns its history
+func (server *WSServer) touchPollLease(sessionId string) *sessionHistory {
+	server.mutex.Lock()
+	expiresAt := time.Now().Add(server.pollConfig.Linger)
+	if lease := server.pollLeases[sessionId]; lease != nil {
+		lease.expiresAt = expiresAt
+		history := server.getHistory(sessionId)
+		server.mutex.Unlock()
+		return history
+	}
+
+	server.pollLeases[sessionId] = &pollLease{
+		timer: time.AfterFunc(server.pollConfig.Linger, func() {
+			server.expirePollLease(sessionId)
+		}),
+		expiresAt: expiresAt,
+	}
+	history := server.getHistory(sessionId)
+	server.mutex.Unlock()
+
+	server.registerSessionForMessages(sessionId)
+	fmt.Printf("Session %s is polled\n", sessionId)
+	return history
+}
+
+// expirePollLease deregisters the session if it was not polled during the linger window
+// and has no connection left
+func (server *WSServer) expirePollLease(sessionId string) {
+	server.mutex.Lock()
+	lease := server.pollLeases[sessionId]
+	if lease == nil {
+		server.mutex.Unlock()
+		return
+	}
+	if remaining := time.Until(lease.expiresAt); remaining > 0 {
+		// polled again since the timer was set
+		lease.timer.Reset(remaining)
+		server.mutex.Unlock()
+		return
+	}
+	delete(server.pollLeases, sessionId)
+	forgotten := server.forgetSession(sessionId)
+	server.mutex.Unlock()
+
+	if forgotten {
+		server.deregisterSessionForMessages(sessionId)
+	}
+	fmt.Printf("Session %s is not polled anymore\n", sessionId)
+}
+
+// getAfterSeq reads the sequence number of the last update received by the client, if it
+// sent one. 0 is the cursor of the clients that have not received any update yet.
+func getAfterSeq(r *http.Request) (uint64, bool, error) {
+	afterStr := r.URL.Query().Get(AFTER_QUERY)
+	if afterStr == "" {
+		return 0, false, nil
+	}
+	after, err := strconv.ParseUint(afterStr, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid cursor \"%s\"", afterStr)
+	}
+	return after, after != 0, nil
+}
+
+// getPollWait reads how long the poll can wait for new updates, in seconds
+func getPollWait(r *http.Request) (time.Duration, error) {
+	waitStr := r.URL.Query().Get(WAIT_QUERY)
+	if waitStr == "" {
+		return DEFAULT_POLL_WAIT, nil
+	}
+	wait, err := strconv.Atoi(waitStr)
+	if err != nil || wait < 0 {
+		return 0, fmt.Errorf("invalid wait \"%s\"", waitStr)
+	}
+	return min(time.Duration(wait)*time.Second, MAX_POLL_WAIT), nil
+}
+
+// pollHandler returns the updates of the session following the cursor sent as after.
+// When there is none yet, the request waits for the next update, up to wait seconds.
+// Without a cursor, or with one that is not kept anymore, the history of the session is
+// returned instead, along with the cursor to poll the following updates. The history of
+// a session without any update yet is only returned once the first update comes, or
+// when the wait is over.
+func pollHandler(wsServer *WSServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		sessionUUID := vars["id"]
+		if sessionUUID == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("id is empty"))
+			return
+		}
+
+		historyDepth, err := wsServer.getHistoryDepth(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		if !wsServer.checkOrigin(r) {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("origin not allowed"))
+			return
+		}
+
+		protocolVersion, err := getProtocolVersion(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		wait, err := getPollWait(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		after, _, err := getAfterSeq(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		if _, tokenErr := wsServer.checkStreamToken(sessionUUID, getStreamToken(r)); tokenErr != nil {
+			fmt.Printf("Rejected poll of session %s: %s\n", sessionUUID, tokenErr.Error())
+			writeTokenError(w, tokenErr)
+			return
+		}
+
+		history := wsServer.touchPollLease(sessionUUID)
+		// the linger window starts when the poll ends
+		defer wsServer.touchPollLease(sessionUUID)
+
+		response := PollResponse{Updates: []PollUpdate{}}
+		timeout := time.NewTimer(wait)
+		defer timeout.Stop()
+
+		for {
+			changed := history.waitChannel()
+			updates, ok := history.updatesAfter(after)
+			if !ok {
+				var messages []MessageUpdate
+				response.Reset = true
+				messages, response.Cursor = history.sequencedSnapshot(historyDepth)
+				response.Updates = []PollUpdate{}
+				for _, msg := range messages {
+					response.Updates = append(response.Updates, PollUpdate{Update: msg.ForProtocol(protocolVersion)})
+				}
+				if response.Cursor != 0 {
+					break
+				}
+				// nothing was sent to the session yet, wait for its first update
+			} else if len(updates) > 0 {
+				response.Reset = false
+				for _, update := range updates {
+					response.Updates = append(response.Updates, PollUpdate{Seq: update.seq, Update: update.update.ForProtocol(protocolVersion)})
+				}
+				response.Cursor = updates[len(updates)-1].seq
+				break
+			} else {
+				response.Cursor = after
+			}
+
+			select {
+			case <-changed:
+				continue
+			case <-timeout.C:
+			case <-wsServer.shutdown:
+			case <-r.Context().Done():
+				return
+			}
+			break
+		}
+
+		responseStr, err := json.Marshal(response)
+		if err != nil {
+			fmt.Printf("Error found while marshal poll response:\n%s\n", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(responseStr)
+	}
+}
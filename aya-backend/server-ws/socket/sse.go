@@ -0,0 +1,229 @@
+package socket
+
+import (
+	. "aya-backend/server-ws/chat_service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	LAST_EVENT_ID_HEADER = "Last-Event-ID"
+
+	// SSE_KEEPALIVE_INTERVAL is how often a comment is sent on idle event streams,
+	// so that the proxies do not close them
+	SSE_KEEPALIVE_INTERVAL = 15 * time.Second
+)
+
+// writeTokenError answers a plain http request whose viewer token is rejected
+func writeTokenError(w http.ResponseWriter, tokenErr *closeError) {
+	status := http.StatusUnauthorized
+	if tokenErr.code == CloseForbiddenToken {
+		status = http.StatusForbidden
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(tokenErr.reason))
+}
+
+// getLastEventId reads the sequence number of the last event received by the client,
+// which the browsers send when they reconnect an event stream
+func getLastEventId(r *http.Request) (uint64, bool) {
+	lastEventIdStr := strings.TrimSpace(r.Header.Get(LAST_EVENT_ID_HEADER))
+	if lastEventIdStr == "" {
+		return 0, false
+	}
+	lastEventId, err := strconv.ParseUint(lastEventIdStr, 10, 64)
+	if err != nil || lastEventId == 0 {
+		return 0, false
+	}
+	return lastEventId, true
+}
+
+// writeEvent writes an event with the update, the id of the event is omitted if seq is 0
+func writeEvent(w http.ResponseWriter, seq uint64, update any) error {
+	data, err := json.Marshal(update)
+	if err != nil {
+		fmt.Printf("Error found while marshal msg:\n%s\n", err.Error())
+		return nil
+	}
+	return writeEventData(w, seq, data)
+}
+
+// writeEventData writes an event with the JSON data
+func writeEventData(w http.ResponseWriter, seq uint64, data []byte) error {
+	var event strings.Builder
+	if seq != 0 {
+		event.WriteString(fmt.Sprintf("id: %d\n", seq))
+	}
+	event.WriteString("data: ")
+	event.Write(data)
+	event.WriteString("\n\n")
+	_, err := w.Write([]byte(event.String()))
+	return err
+}
+
+// writeCloseEvent tells the client why the stream ends, with the code it would get on a websocket
+func writeCloseEvent(w http.ResponseWriter, err error) {
+	var connCloseErr *closeError
+	if !errors.As(err, &connCloseErr) {
+		return
+	}
+	data, _ := json.Marshal(map[string]any{"code": connCloseErr.code, "reason": connCloseErr.reason})
+	_, _ = fmt.Fprintf(w, "event: close\ndata: %s\n\n", data)
+}
+
+// sseHandler streams the updates of a session as server-sent events. The id of the
+// events is the sequence number of the updates, so that a client reconnecting with
+// Last-Event-ID receives the updates it missed, as long as they are still kept.
+func sseHandler(wsServer *WSServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wsServer.handlers.Add(1)
+		defer wsServer.handlers.Done()
+
+		vars := mux.Vars(r)
+		sessionUUID := vars["id"]
+		if sessionUUID == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("id is empty"))
+			return
+		}
+
+		historyDepth, err := wsServer.getHistoryDepth(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		if !wsServer.checkOrigin(r) {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("origin not allowed"))
+			return
+		}
+
+		protocolVersion, err := getProtocolVersion(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		tokenClaims, tokenErr := wsServer.checkStreamToken(sessionUUID, getStreamToken(r))
+		if tokenErr != nil {
+			fmt.Printf("Rejected event stream of session %s: %s\n", sessionUUID, tokenErr.Error())
+			writeTokenError(w, tokenErr)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte("streaming is not supported"))
+			return
+		}
+
+		lastEventId, resume := getLastEventId(r)
+
+		// the events are the JSON frames of the websockets, which the other event streams share
+		client := newStreamClient(protocolVersion, JSONEncoding, nil)
+
+		var resumeUpdates []sequencedUpdate
+		var replayMessages []MessageUpdate
+		var replaySeq uint64
+		connectionId, conn := wsServer.addConnection(sessionUUID, client, func(history *sessionHistory) {
+			if resume {
+				resumeUpdates, resume = history.updatesAfter(lastEventId)
+			}
+			if !resume {
+				replayMessages, replaySeq = history.sequencedSnapshot(historyDepth)
+			}
+		})
+		defer wsServer.removeConnection(sessionUUID, connectionId)
+
+		fmt.Printf("Session %s is streamed, event stream conn#%d\n", sessionUUID, connectionId)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		// disable the buffering of nginx, which would hold the events back
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		controller := http.NewResponseController(w)
+		write := func(seq uint64, update any) error {
+			_ = controller.SetWriteDeadline(time.Now().Add(wsServer.queueConfig.WriteTimeout))
+			return writeEvent(w, seq, update)
+		}
+		writeUpdate := func(update sequencedUpdate) error {
+			frame, _, err := client.encodeUpdate(update)
+			if err != nil {
+				fmt.Printf("Error found while marshal msg:\n%s\n", err.Error())
+				return nil
+			}
+			_ = controller.SetWriteDeadline(time.Now().Add(wsServer.queueConfig.WriteTimeout))
+			return writeEventData(w, update.seq, frame.data)
+		}
+
+		var connectErr error
+		if resume {
+			for _, update := range resumeUpdates {
+				if connectErr = writeUpdate(update); connectErr != nil {
+					break
+				}
+			}
+		} else {
+			for _, replayMessage := range replayMessages {
+				if connectErr = write(replayMessage.Seq, replayMessage.ForProtocol(protocolVersion)); connectErr != nil {
+					break
+				}
+			}
+			if connectErr == nil && replaySeq != 0 {
+				// an event without data only sets the id the client resumes from
+				_, connectErr = fmt.Fprintf(w, "id: %d\n\n", replaySeq)
+			}
+		}
+		flusher.Flush()
+
+		keepalive := time.NewTicker(SSE_KEEPALIVE_INTERVAL)
+		defer keepalive.Stop()
+
+		var tokenCheck <-chan time.Time
+		if tokenClaims != nil {
+			tokenTicker := time.NewTicker(STREAM_TOKEN_CHECK_INTERVAL)
+			defer tokenTicker.Stop()
+			tokenCheck = tokenTicker.C
+		}
+
+		for connectErr == nil {
+			select {
+			case newMessage := <-conn.queue:
+				connectErr = writeUpdate(newMessage)
+			case <-keepalive.C:
+				_ = controller.SetWriteDeadline(time.Now().Add(wsServer.queueConfig.WriteTimeout))
+				_, connectErr = w.Write([]byte(": keepalive\n\n"))
+			case <-tokenCheck:
+				if tokenErr := wsServer.recheckStreamToken(tokenClaims); tokenErr != nil {
+					connectErr = tokenErr
+				}
+			case <-conn.evicted:
+				connectErr = conn.evictionError()
+			case <-wsServer.shutdown:
+				connectErr = errServerShutdown
+			case <-r.Context().Done():
+				connectErr = r.Context().Err()
+			}
+			if connectErr == nil {
+				flusher.Flush()
+			}
+		}
+
+		writeCloseEvent(w, connectErr)
+		flusher.Flush()
+		fmt.Printf("End event stream of %s, conn#%d: %s\n", sessionUUID, connectionId, connectErr.Error())
+	}
+}
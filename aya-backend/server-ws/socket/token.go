@@ -0,0 +1,117 @@
+package socket
+
+import (
+	models "aya-backend/db-models"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// STREAM_TOKEN_LEGACY_MODE_ENV allows the clients without a token to read the stream of a session from its id
+	STREAM_TOKEN_LEGACY_MODE_ENV = "STREAM_TOKEN_LEGACY_MODE"
+
+	TOKEN_QUERY = "token"
+
+	// STREAM_TOKEN_CHECK_INTERVAL is how often the token of an open connection is checked again
+	STREAM_TOKEN_CHECK_INTERVAL = 30 * time.Second
+)
+
+type TokenConfig struct {
+	Secret []byte
+	// LegacyMode lets the clients connect with the session id only
+	LegacyMode bool
+}
+
+func getTokenConfig() TokenConfig {
+	config := TokenConfig{
+		Secret: []byte(os.Getenv(models.STREAM_TOKEN_SECRET_ENV)),
+	}
+
+	if legacyStr := os.Getenv(STREAM_TOKEN_LEGACY_MODE_ENV); legacyStr != "" {
+		legacyMode, err := strconv.ParseBool(legacyStr)
+		if err != nil {
+			fmt.Printf("Invalid %s value \"%s\", legacy mode is disabled\n", STREAM_TOKEN_LEGACY_MODE_ENV, legacyStr)
+		} else {
+			config.LegacyMode = legacyMode
+		}
+	}
+
+	if len(config.Secret) == 0 {
+		fmt.Printf("%s environment variable not set, every stream token is rejected\n", models.STREAM_TOKEN_SECRET_ENV)
+	}
+	if config.LegacyMode {
+		fmt.Println("Stream token legacy mode enabled, the sessions can be read without a token")
+	}
+	return config
+}
+
+// getStreamToken reads the token from the query, which browsers can set on websockets,
+// or from the Authorization header. The token is removed from the url of the request,
+// so that it is never printed along with the request.
+func getStreamToken(r *http.Request) string {
+	query := r.URL.Query()
+	if token := query.Get(TOKEN_QUERY); token != "" {
+		query.Del(TOKEN_QUERY)
+		r.URL.RawQuery = query.Encode()
+		r.RequestURI = r.URL.RequestURI()
+		return token
+	}
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// checkStreamToken checks that the token gives access to the session. It returns no
+// claims when a client without a token is let in by the legacy mode.
+func (server *WSServer) checkStreamToken(sessionId string, tokenStr string) (*jwt.RegisteredClaims, *closeError) {
+	if tokenStr == "" {
+		if server.tokenConfig.LegacyMode {
+			return nil, nil
+		}
+		return nil, &closeError{code: CloseInvalidToken, reason: "token is required"}
+	}
+	if len(server.tokenConfig.Secret) == 0 {
+		return nil, &closeError{code: CloseInvalidToken, reason: "stream tokens are not configured"}
+	}
+
+	claims, err := models.ParseStreamToken(server.tokenConfig.Secret, tokenStr, sessionId)
+	switch {
+	case errors.Is(err, models.ErrStreamTokenSession):
+		return nil, &closeError{code: CloseForbiddenToken, reason: err.Error()}
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return nil, &closeError{code: CloseInvalidToken, reason: "token expired"}
+	case err != nil:
+		return nil, &closeError{code: CloseInvalidToken, reason: "invalid token"}
+	}
+
+	if tokenErr := server.checkRevocation(claims); tokenErr != nil {
+		return nil, tokenErr
+	}
+	return claims, nil
+}
+
+// checkRevocation checks whether the token was revoked. The token is accepted when
+// the database cannot be read, so that a database hiccup does not drop every viewer.
+func (server *WSServer) checkRevocation(claims *jwt.RegisteredClaims) *closeError {
+	revoked, err := server.infoDB.IsStreamTokenRevoked(claims.ID)
+	if err != nil {
+		fmt.Printf("Cannot check the revocation of token %s: %s\n", claims.ID, err.Error())
+		return nil
+	}
+	if revoked {
+		return &closeError{code: CloseForbiddenToken, reason: "token revoked"}
+	}
+	return nil
+}
+
+// recheckStreamToken checks that the token of an open connection is still valid
+func (server *WSServer) recheckStreamToken(claims *jwt.RegisteredClaims) *closeError {
+	if claims.ExpiresAt != nil && time.Now().After(claims.ExpiresAt.Time) {
+		return &closeError{code: CloseInvalidToken, reason: "token expired"}
+	}
+	return server.checkRevocation(claims)
+}
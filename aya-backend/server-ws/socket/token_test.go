@@ -0,0 +1,148 @@
+package socket
+
+import (
+	models "aya-backend/db-models"
+	"aya-backend/server-ws/db"
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testTokenSecret = []byte("test secret")
+
+// newTokenTestServer returns a server checking the tokens against a new database
+func newTokenTestServer(t *testing.T, legacyMode bool) (*WSServer, *gorm.DB) {
+	t.Helper()
+	gormDB, err := gorm.Open(sqlite.Open(path.Join(t.TempDir(), "aya.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gormDB.AutoMigrate(&models.GORMStreamToken{}); err != nil {
+		t.Fatal(err)
+	}
+	return &WSServer{
+		infoDB:      db.NewInfoDB(gormDB),
+		tokenConfig: TokenConfig{Secret: testTokenSecret, LegacyMode: legacyMode},
+	}, gormDB
+}
+
+// createTestToken stores a token of the session, and returns it signed
+func createTestToken(t *testing.T, gormDB *gorm.DB, sessionId uuid.UUID, expiresAt time.Time, revoked bool) string {
+	t.Helper()
+	token := models.GORMStreamToken{SessionUUID: sessionId, ExpiresAt: expiresAt}
+	if revoked {
+		revokedAt := time.Now()
+		token.RevokedAt = &revokedAt
+	}
+	if err := gormDB.Create(&token).Error; err != nil {
+		t.Fatal(err)
+	}
+	tokenStr, err := token.Sign(testTokenSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenStr
+}
+
+func TestCheckStreamToken(t *testing.T) {
+	sessionId := uuid.New()
+	server, gormDB := newTokenTestServer(t, false)
+	legacyServer, legacyDB := newTokenTestServer(t, true)
+	unconfiguredServer, _ := newTokenTestServer(t, false)
+	unconfiguredServer.tokenConfig.Secret = nil
+
+	valid := createTestToken(t, gormDB, sessionId, time.Now().Add(time.Hour), false)
+	tests := []struct {
+		name      string
+		server    *WSServer
+		sessionId uuid.UUID
+		tokenStr  string
+		// wantCode is the close code the connection is refused with, 0 if it is accepted
+		wantCode int
+	}{
+		{name: "valid", server: server, sessionId: sessionId, tokenStr: valid},
+		{name: "expired", server: server, sessionId: sessionId, tokenStr: createTestToken(t, gormDB, sessionId, time.Now().Add(-time.Minute), false), wantCode: CloseInvalidToken},
+		{name: "wrong session", server: server, sessionId: uuid.New(), tokenStr: valid, wantCode: CloseForbiddenToken},
+		{name: "revoked", server: server, sessionId: sessionId, tokenStr: createTestToken(t, gormDB, sessionId, time.Now().Add(time.Hour), true), wantCode: CloseForbiddenToken},
+		{name: "not stored", server: legacyServer, sessionId: sessionId, tokenStr: valid, wantCode: CloseForbiddenToken},
+		{name: "malformed", server: server, sessionId: sessionId, tokenStr: "not a token", wantCode: CloseInvalidToken},
+		{name: "missing", server: server, sessionId: sessionId, wantCode: CloseInvalidToken},
+		{name: "not configured", server: unconfiguredServer, sessionId: sessionId, tokenStr: valid, wantCode: CloseInvalidToken},
+		{name: "legacy mode without token", server: legacyServer, sessionId: sessionId},
+		{name: "legacy mode with valid token", server: legacyServer, sessionId: sessionId, tokenStr: createTestToken(t, legacyDB, sessionId, time.Now().Add(time.Hour), false)},
+		{name: "legacy mode with revoked token", server: legacyServer, sessionId: sessionId, tokenStr: createTestToken(t, legacyDB, sessionId, time.Now().Add(time.Hour), true), wantCode: CloseForbiddenToken},
+		{name: "legacy mode with malformed token", server: legacyServer, sessionId: sessionId, tokenStr: "not a token", wantCode: CloseInvalidToken},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, tokenErr := test.server.checkStreamToken(test.sessionId.String(), test.tokenStr)
+			if test.wantCode == 0 {
+				if tokenErr != nil {
+					t.Fatalf("token is rejected: %s", tokenErr.Error())
+				}
+				if test.tokenStr != "" && claims == nil {
+					t.Error("token is accepted without claims")
+				}
+				return
+			}
+			if tokenErr == nil {
+				t.Fatal("token is accepted")
+			}
+			if tokenErr.code != test.wantCode {
+				t.Errorf("close code = %d, want %d (%s)", tokenErr.code, test.wantCode, tokenErr.reason)
+			}
+		})
+	}
+}
+
+func TestRecheckStreamToken(t *testing.T) {
+	sessionId := uuid.New()
+	server, gormDB := newTokenTestServer(t, false)
+	tokenStr := createTestToken(t, gormDB, sessionId, time.Now().Add(time.Hour), false)
+	claims, tokenErr := server.checkStreamToken(sessionId.String(), tokenStr)
+	if tokenErr != nil {
+		t.Fatal(tokenErr)
+	}
+	if tokenErr := server.recheckStreamToken(claims); tokenErr != nil {
+		t.Fatalf("open connection is closed: %s", tokenErr.Error())
+	}
+
+	gormDB.Model(&models.GORMStreamToken{}).Where("uuid = ?", claims.ID).Update("revoked_at", time.Now())
+	if tokenErr := server.recheckStreamToken(claims); tokenErr == nil || tokenErr.code != CloseForbiddenToken {
+		t.Errorf("revoked token gives %v, want close code %d", tokenErr, CloseForbiddenToken)
+	}
+
+	claims.ExpiresAt.Time = time.Now().Add(-time.Second)
+	if tokenErr := server.recheckStreamToken(claims); tokenErr == nil || tokenErr.code != CloseInvalidToken {
+		t.Errorf("expired token gives %v, want close code %d", tokenErr, CloseInvalidToken)
+	}
+}
+
+func TestGetStreamTokenRedactsQuery(t *testing.T) {
+	r := httptest.NewRequest("GET", "/stream/session?history=10&token=secret-token&protocol=2", nil)
+	if tokenStr := getStreamToken(r); tokenStr != "secret-token" {
+		t.Fatalf("token = %s, want secret-token", tokenStr)
+	}
+	for _, printed := range []string{r.URL.String(), r.RequestURI} {
+		if strings.Contains(printed, "secret-token") || strings.Contains(printed, TOKEN_QUERY+"=") {
+			t.Errorf("token is still in %s", printed)
+		}
+	}
+	if r.URL.Query().Get(HISTORY_QUERY) != "10" || r.URL.Query().Get(PROTOCOL_QUERY) != "2" {
+		t.Errorf("other parameters are lost: %s", r.URL.String())
+	}
+
+	r = httptest.NewRequest("GET", "/stream/session", nil)
+	r.Header.Set("Authorization", "Bearer header-token")
+	if tokenStr := getStreamToken(r); tokenStr != "header-token" {
+		t.Errorf("token = %s, want header-token", tokenStr)
+	}
+}
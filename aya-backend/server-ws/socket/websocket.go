@@ -3,49 +3,240 @@ package socket
 import (
 	. "aya-backend/server-ws/chat_service"
 	. "aya-backend/server-ws/chat_service/composed"
+	"aya-backend/server-ws/db"
 	"aya-backend/server-ws/hubs"
-	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
 	ws "github.com/gorilla/websocket"
 	"net/http"
-	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	WEBSITE_HOST_ORIGIN_ENV = "WEBSITE_HOST_ORIGIN"
-)
 
-var (
-	acceptableOrigin []string
+	HISTORY_QUERY  = "history"
+	PROTOCOL_QUERY = "protocol"
+
+	CONTROL_RESPONSE_QUEUE_SIZE = 16
+
+	// SHUTDOWN_TIMEOUT is how long the server waits for the connections to be closed when shutting down
+	SHUTDOWN_TIMEOUT = 5 * time.Second
 )
 
 type WSConnectionMap struct {
-	MessageConnChan map[int]chan MessageUpdate
-	CountId         int
+	connections map[int]*wsConnection
+	CountId     int
+	// DroppedMessages counts the messages dropped for the slow connections of the session
+	DroppedMessages atomic.Uint64
 }
 
 type WSServer struct {
 	mutex sync.RWMutex
-	upg   *ws.Upgrader
+	// registration orders the (de)registrations of the sessions to the message hub, which
+	// are done without the mutex held since deregistering a resource can block on its emitter
+	registration sync.Mutex
+	upg          *ws.Upgrader
 
 	msgHub           *hubs.MessageHub
 	resourceRegister *MessageEmitter
+	infoDB           *db.InfoDB
+
+	historyConfig   HistoryConfig
+	histories       map[string]*sessionHistory
+	queueConfig     QueueConfig
+	keepaliveConfig KeepaliveConfig
+	tokenConfig     TokenConfig
+	pollConfig      PollConfig
+	pollLeases      map[string]*pollLease
+	originConfig    OriginConfig
 
 	ChanMap map[string]*WSConnectionMap
+
+	// shutdown is closed when the server shuts down, handlers counts the streams still open
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+	handlers     sync.WaitGroup
+}
+
+// getHistory returns the history of the session, creating it if needed.
+// Must be called with the mutex held.
+func (server *WSServer) getHistory(sessionId string) *sessionHistory {
+	if server.histories[sessionId] == nil {
+		server.histories[sessionId] = newSessionHistory(server.historyConfig)
+	}
+	return server.histories[sessionId]
 }
 
+// getHistoryDepth reads the number of messages to replay from the request query.
+// The depth defaults to, and is capped by, the configured maximum number of messages.
+func (server *WSServer) getHistoryDepth(r *http.Request) (int, error) {
+	depthStr := r.URL.Query().Get(HISTORY_QUERY)
+	if depthStr == "" {
+		return server.historyConfig.MaxMessages, nil
+	}
+	depth, err := strconv.Atoi(depthStr)
+	if err != nil || depth < 0 {
+		return 0, fmt.Errorf("invalid history depth \"%s\"", depthStr)
+	}
+	return min(depth, server.historyConfig.MaxMessages), nil
+}
+
+// getProtocolVersion reads the protocol version of the client from the request query.
+// Clients that do not send it get the first version of the protocol.
+func getProtocolVersion(r *http.Request) (ProtocolVersion, error) {
+	versionStr := r.URL.Query().Get(PROTOCOL_QUERY)
+	if versionStr == "" {
+		return DefaultProtocolVersion, nil
+	}
+	return ParseProtocolVersion(versionStr)
+}
+
+// historySnapshot returns up to depth of the most recent messages of the session
+func (server *WSServer) historySnapshot(sessionId string, depth int) []MessageUpdate {
+	server.mutex.RLock()
+	history := server.histories[sessionId]
+	server.mutex.RUnlock()
+	if history == nil {
+		return []MessageUpdate{}
+	}
+	return history.snapshot(depth)
+}
+
+// registerSessionForMessages registers the session to the message hub. Must be called
+// without the mutex held.
 func (server *WSServer) registerSessionForMessages(sessionId string) {
+	server.registration.Lock()
+	defer server.registration.Unlock()
 	server.msgHub.AddSession(sessionId)
 }
 
+// deregisterSessionForMessages deregisters the session from the message hub, unless it got
+// a connection or a poll lease again since it was forgotten. Must be called without the mutex held.
 func (server *WSServer) deregisterSessionForMessages(sessionId string) {
+	server.registration.Lock()
+	defer server.registration.Unlock()
+	server.mutex.RLock()
+	inUse := server.sessionInUse(sessionId)
+	server.mutex.RUnlock()
+	if inUse {
+		return
+	}
 	server.msgHub.RemoveSession(sessionId)
 }
 
+// addConnection adds a connection to the stream of the session, and registers the session
+// for messages. The updates are encoded for the client of the connection. replay is called
+// with the mutex held, so that the messages it reads from the history are neither missed
+// nor sent twice by the connection.
+func (server *WSServer) addConnection(sessionId string, client *streamClient, replay func(history *sessionHistory)) (int, *wsConnection) {
+	server.mutex.Lock()
+	conn := newWSConnection(server.queueConfig.Size, client)
+	if server.ChanMap[sessionId] == nil {
+		server.ChanMap[sessionId] = &WSConnectionMap{
+			connections: make(map[int]*wsConnection),
+			CountId:     0,
+		}
+	}
+	server.ChanMap[sessionId].CountId += 1
+
+	connectionId := server.ChanMap[sessionId].CountId
+
+	server.ChanMap[sessionId].connections[connectionId] = conn
+	replay(server.getHistory(sessionId))
+	server.mutex.Unlock()
+
+	server.registerSessionForMessages(sessionId)
+	return connectionId, conn
+}
+
+// sessionInUse returns whether the session has connections or a poll lease.
+// Must be called with the mutex held.
+func (server *WSServer) sessionInUse(sessionId string) bool {
+	if server.ChanMap[sessionId] != nil && len(server.ChanMap[sessionId].connections) > 0 {
+		return true
+	}
+	// the session lingers while it is polled
+	return server.pollLeases[sessionId] != nil
+}
+
+// forgetSession drops the history of the session once it has neither connections nor a
+// poll lease left, and returns whether it did. The caller then deregisters the session
+// with deregisterSessionForMessages, after releasing the mutex. Must be called with the mutex held.
+func (server *WSServer) forgetSession(sessionId string) bool {
+	if server.sessionInUse(sessionId) {
+		return false
+	}
+	delete(server.ChanMap, sessionId)
+	delete(server.histories, sessionId)
+	return true
+}
+
+// removeConnection removes a connection of the session, and deregisters the session
+// once its last connection is removed
+func (server *WSServer) removeConnection(sessionId string, connectionId int) {
+	server.mutex.Lock()
+	forgotten := false
+	if server.ChanMap[sessionId] != nil {
+		delete(server.ChanMap[sessionId].connections, connectionId)
+		forgotten = server.forgetSession(sessionId)
+	}
+	server.mutex.Unlock()
+
+	if forgotten {
+		server.deregisterSessionForMessages(sessionId)
+	}
+}
+
+// closeSession disconnects every connection of the session, with the reason sent in the
+// close frame, and ends its poll lease. The session is forgotten once they are all gone.
+func (server *WSServer) closeSession(sessionId string, err error) {
+	server.mutex.Lock()
+	forgotten := false
+	if lease := server.pollLeases[sessionId]; lease != nil {
+		lease.timer.Stop()
+		delete(server.pollLeases, sessionId)
+		forgotten = server.forgetSession(sessionId)
+	}
+	if server.ChanMap[sessionId] != nil {
+		for _, conn := range server.ChanMap[sessionId].connections {
+			conn.evict(err)
+		}
+	}
+	server.mutex.Unlock()
+
+	if forgotten {
+		server.deregisterSessionForMessages(sessionId)
+	}
+}
+
+// Close disconnects every client with a going away close code, and waits for the
+// connections to be closed, up to SHUTDOWN_TIMEOUT
+func (server *WSServer) Close() {
+	server.shutdownOnce.Do(func() {
+		close(server.shutdown)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		server.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(SHUTDOWN_TIMEOUT):
+		fmt.Println("Timed out while closing the stream connections")
+	}
+}
+
 func wsHandler(wsServer *WSServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		wsServer.handlers.Add(1)
+		defer wsServer.handlers.Done()
+
 		vars := mux.Vars(r)
 		sessionUUID := vars["id"]
 		if sessionUUID == "" {
@@ -54,58 +245,200 @@ func wsHandler(wsServer *WSServer) http.HandlerFunc {
 			return
 		}
 
-		c, err := wsServer.upg.Upgrade(w, r, nil)
+		historyDepth, err := wsServer.getHistoryDepth(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		protocolVersion, err := getProtocolVersion(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		// a reconnecting client sends the sequence number of the last update it received.
+		// The clients that can resume send 0 before they received anything, and are told
+		// the sequence number of the history they get, which the other clients are not,
+		// since they only expect updates.
+		after, resume, err := getAfterSeq(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+		resumable := r.URL.Query().Has(AFTER_QUERY)
+
+		// the token is checked before the upgrade, but rejected after it, so that the client gets the close code
+		tokenClaims, tokenErr := wsServer.checkStreamToken(sessionUUID, getStreamToken(r))
+
+		var responseHeader http.Header
+		encoding, negotiated := negotiateEncoding(r)
+		if negotiated {
+			responseHeader = http.Header{"Sec-Websocket-Protocol": {string(encoding)}}
+		}
+
+		c, err := wsServer.upg.Upgrade(w, r, responseHeader)
 		if err != nil {
 			fmt.Printf("upgrade: %s\n", err.Error())
 			return
 		}
 
-		wsServer.mutex.Lock()
-		msgChannel := make(chan MessageUpdate)
-		if wsServer.ChanMap[sessionUUID] == nil {
-			wsServer.ChanMap[sessionUUID] = &WSConnectionMap{
-				MessageConnChan: make(map[int]chan MessageUpdate),
-				CountId:         0,
-			}
+		if tokenErr != nil {
+			fmt.Printf("Rejected connection to session %s: %s\n", sessionUUID, tokenErr.Error())
+			writeClose(c, tokenErr, wsServer.queueConfig.WriteTimeout)
+			_ = c.Close()
+			return
 		}
-		wsServer.ChanMap[sessionUUID].CountId += 1
 
-		wsConnectionId := wsServer.ChanMap[sessionUUID].CountId
+		client := newStreamClient(protocolVersion, encoding, wsServer.resourceRegister.Sources())
 
-		wsServer.ChanMap[sessionUUID].MessageConnChan[wsConnectionId] = msgChannel
-		wsServer.registerSessionForMessages(sessionUUID)
-		wsServer.mutex.Unlock()
+		var replayMessages []MessageUpdate
+		var replaySeq uint64
+		var resumeUpdates []sequencedUpdate
+		var gap *GapResponse
+		wsConnectionId, wsConn := wsServer.addConnection(sessionUUID, client, func(history *sessionHistory) {
+			if resume {
+				resumeUpdates, resume = history.updatesAfter(after)
+				if resume {
+					return
+				}
+				// the history replaces the updates that are not kept anymore
+				replayMessages, replaySeq = history.sequencedSnapshot(historyDepth)
+				gap = &GapResponse{
+					frameHeader: frameHeader{Type: GapFrame},
+					After:       after,
+					Seq:         replaySeq,
+				}
+				return
+			}
+			replayMessages, replaySeq = history.sequencedSnapshot(historyDepth)
+		})
 
-		fmt.Printf("Session %s is connected\n", sessionUUID)
+		fmt.Printf("Session %s is connected, encoding %s\n", sessionUUID, encoding)
 
-		errChannel := make(chan error)
+		// buffered, so that the reader can exit when the writer has already stopped
+		errChannel := make(chan error, 1)
+		responses := make(chan any, CONTROL_RESPONSE_QUEUE_SIZE)
+		writerDone := make(chan struct{})
+
+		// a peer that answers neither the pings nor anything else is dead, the read fails once the deadline passes
+		pongTimeout := wsServer.keepaliveConfig.PongTimeout
+		_ = c.SetReadDeadline(time.Now().Add(pongTimeout))
+		c.SetPongHandler(func(string) error {
+			return c.SetReadDeadline(time.Now().Add(pongTimeout))
+		})
 
 		go func() {
 			for {
-				_, msg, err := c.ReadMessage()
-				fmt.Printf("Message from connection: %s\n", string(msg))
+				messageType, msg, err := c.ReadMessage()
 				if err != nil {
 					errChannel <- err
 					return
 				}
+				_ = c.SetReadDeadline(time.Now().Add(pongTimeout))
+				response := wsServer.handleCommand(sessionUUID, client, messageType, msg)
+				select {
+				case responses <- response:
+				case <-writerDone:
+					return
+				}
 			}
 		}()
 
+		var tokenCheck <-chan time.Time
+		if tokenClaims != nil {
+			tokenTicker := time.NewTicker(STREAM_TOKEN_CHECK_INTERVAL)
+			defer tokenTicker.Stop()
+			tokenCheck = tokenTicker.C
+		}
+
+		ping := time.NewTicker(wsServer.keepaliveConfig.PingInterval)
+		defer ping.Stop()
+
+		writeUpdate := func(update sequencedUpdate) error {
+			frame, subscribed, err := client.encodeUpdate(update)
+			if !subscribed {
+				return nil
+			}
+			if err != nil {
+				fmt.Printf("Error found while marshal msg:\n%s\n", err.Error())
+				return nil
+			}
+			_ = c.SetWriteDeadline(time.Now().Add(wsServer.queueConfig.WriteTimeout))
+			err = c.WritePreparedMessage(frame.prepared)
+			if err != nil {
+				fmt.Printf("Error counter while send msg:\n%s\n", err.Error())
+			}
+			return err
+		}
+		writeResponse := func(response any) error {
+			responseStr, err := client.encoding.marshal(response)
+			if err != nil {
+				fmt.Printf("Error found while marshal response:\n%s\n", err.Error())
+				return nil
+			}
+			_ = c.SetWriteDeadline(time.Now().Add(wsServer.queueConfig.WriteTimeout))
+			err = c.WriteMessage(client.encoding.messageType(), responseStr)
+			if err != nil {
+				fmt.Printf("Error counter while send response:\n%s\n", err.Error())
+			}
+			return err
+		}
+
 		var connectErr error
 
+		if gap != nil {
+			fmt.Printf("Session %s conn#%d cannot resume after %d, sending the history up to %d\n", sessionUUID, wsConnectionId, gap.After, gap.Seq)
+			connectErr = writeResponse(gap)
+		} else if resume {
+			fmt.Printf("Session %s conn#%d resumes after %d, %d update(s) missed\n", sessionUUID, wsConnectionId, after, len(resumeUpdates))
+		}
+
+		for _, replayMessage := range replayMessages {
+			if connectErr != nil {
+				break
+			}
+			connectErr = writeUpdate(newSequencedUpdate(replayMessage.Seq, replayMessage))
+		}
+		if connectErr == nil && resumable && gap == nil && !resume && replaySeq != 0 {
+			// the gap frame already tells the sequence number of the history
+			connectErr = writeResponse(SyncResponse{
+				frameHeader: frameHeader{Type: SyncFrame},
+				Seq:         replaySeq,
+			})
+		}
+		for _, resumeUpdate := range resumeUpdates {
+			if connectErr != nil {
+				break
+			}
+			connectErr = writeUpdate(resumeUpdate)
+		}
+
 		for connectErr == nil {
 			select {
-			case newMessage := <-msgChannel:
-				newMessageStr, err := json.Marshal(newMessage)
+			case newMessage := <-wsConn.queue:
+				connectErr = writeUpdate(newMessage)
+			case response := <-responses:
+				connectErr = writeResponse(response)
+			case <-ping.C:
+				err := c.WriteControl(ws.PingMessage, nil, time.Now().Add(wsServer.queueConfig.WriteTimeout))
 				if err != nil {
-					fmt.Printf("Error found while marshal msg:\n%s\n", err.Error())
-					continue
-				}
-				err = c.WriteMessage(ws.TextMessage, newMessageStr)
-				if err != nil {
-					fmt.Printf("Error counter while send msg:\n%s\n", err.Error())
+					fmt.Printf("Error counter while send ping:\n%s\n", err.Error())
 					connectErr = err
 				}
+			case <-tokenCheck:
+				if tokenErr := wsServer.recheckStreamToken(tokenClaims); tokenErr != nil {
+					fmt.Printf("Closing %s conn#%d: %s\n", sessionUUID, wsConnectionId, tokenErr.Error())
+					connectErr = tokenErr
+				}
+			case <-wsConn.evicted:
+				connectErr = wsConn.evictionError()
+				fmt.Printf("Closing %s conn#%d: %s\n", sessionUUID, wsConnectionId, connectErr.Error())
+			case <-wsServer.shutdown:
+				connectErr = errServerShutdown
 			case err := <-errChannel:
 				if err != nil {
 					fmt.Printf("Error from connection:\n%s\n", err.Error())
@@ -115,16 +448,11 @@ func wsHandler(wsServer *WSServer) http.HandlerFunc {
 		}
 
 		fmt.Printf("End sending message to %s, conn#%d, start cleaning up\n", sessionUUID, wsConnectionId)
+		close(writerDone)
+		writeClose(c, connectErr, wsServer.queueConfig.WriteTimeout)
 		_ = c.Close()
 		fmt.Printf("close websocket to %s\n", sessionUUID)
-		wsServer.mutex.Lock()
-		if wsServer.ChanMap[sessionUUID] != nil {
-			delete(wsServer.ChanMap[sessionUUID].MessageConnChan, wsConnectionId)
-			if len(wsServer.ChanMap[sessionUUID].MessageConnChan) == 0 {
-				wsServer.deregisterSessionForMessages(sessionUUID)
-			}
-		}
-		wsServer.mutex.Unlock()
+		wsServer.removeConnection(sessionUUID, wsConnectionId)
 		fmt.Printf("Session %s is disconnected\n", sessionUUID)
 	}
 }
@@ -133,26 +461,38 @@ func NewWSServer(
 	s *mux.Router,
 	msgHub *hubs.MessageHub,
 	resourceRegister *MessageEmitter,
+	infoDB *db.InfoDB,
 ) (*WSServer, error) {
 
-	websiteOrigin := os.Getenv(WEBSITE_HOST_ORIGIN_ENV)
-	if websiteOrigin != "" {
-		acceptableOrigin = append(acceptableOrigin, websiteOrigin)
-	}
-
-	upg := ws.Upgrader{}
-
-	upg.CheckOrigin = func(r *http.Request) bool {
-		return true
+	upg := ws.Upgrader{
+		EnableCompression: getCompressionEnabled(),
 	}
 
 	wsServer := WSServer{
 		upg:              &upg,
 		msgHub:           msgHub,
 		resourceRegister: resourceRegister,
+		infoDB:           infoDB,
+		historyConfig:    getHistoryConfig(),
+		histories:        make(map[string]*sessionHistory),
+		queueConfig:      getQueueConfig(),
+		keepaliveConfig:  getKeepaliveConfig(),
+		tokenConfig:      getTokenConfig(),
+		pollConfig:       getPollConfig(),
+		pollLeases:       make(map[string]*pollLease),
+		originConfig:     getOriginConfig(),
 		ChanMap:          make(map[string]*WSConnectionMap),
+		shutdown:         make(chan struct{}),
 	}
 
+	upg.CheckOrigin = wsServer.checkOrigin
+
+	msgHub.OnSessionOff(func(sessionId string) {
+		wsServer.closeSession(sessionId, errSessionOff)
+	})
+
+	s.HandleFunc("/{id}/events", sseHandler(&wsServer)).Methods(http.MethodGet)
+	s.HandleFunc("/{id}/poll", pollHandler(&wsServer)).Methods(http.MethodGet)
 	s.HandleFunc("/{id}", wsHandler(&wsServer))
 
 	fmt.Println("Web socket ready!")
@@ -160,22 +500,53 @@ func NewWSServer(
 	return &wsServer, nil
 }
 
-func (server *WSServer) SendMessageToSession(sessionId string, msg MessageUpdate) {
+// SendMessageToSession sends the update to the connections and the pollers of the session.
+// seq is the sequence number of the update within the session, assigned by the dispatch.
+func (server *WSServer) SendMessageToSession(sessionId string, seq uint64, msg MessageUpdate) {
 	server.mutex.RLock()
 	defer server.mutex.RUnlock()
 
-	if server.ChanMap[sessionId] == nil {
+	history := server.histories[sessionId]
+	if history == nil {
 		fmt.Printf("Do nothing since the session \"%s\" does not exist\n", sessionId)
 		return
 	}
+	seqMsg := newSequencedUpdate(seq, msg)
+	if !history.add(seqMsg) {
+		fmt.Printf("Ignoring update %d of session %s, out of sequence\n", seq, sessionId)
+		return
+	}
 
-	for _, conn := range server.ChanMap[sessionId].MessageConnChan {
-		conn <- msg
+	connMap := server.ChanMap[sessionId]
+	if connMap == nil {
+		return
+	}
+	// encode the update once for each kind of client, rather than once per connection
+	encoded := make(map[frameKey]bool)
+	for _, conn := range connMap.connections {
+		key := conn.client.frameKey()
+		if encoded[key] {
+			continue
+		}
+		encoded[key] = true
+		if _, err := seqMsg.frames.get(key); err != nil {
+			fmt.Printf("Error found while encoding msg as %s:\n%s\n", key.encoding, err.Error())
+		}
+	}
+	for connId, conn := range connMap.connections {
+		if dropped := conn.enqueue(seqMsg, server.queueConfig.Policy); dropped > 0 {
+			total := connMap.DroppedMessages.Add(uint64(dropped))
+			fmt.Printf("Dropped %d message(s) for slow connection %s conn#%d, %d dropped for the session\n", dropped, sessionId, connId, total)
+		}
 	}
 }
 
-func (server *WSServer) SendMessageToSessions(sessionIds []string, msg MessageUpdate) {
-	for _, session := range sessionIds {
-		server.SendMessageToSession(session, msg)
+// DroppedMessages returns the number of messages dropped for the slow connections of the session
+func (server *WSServer) DroppedMessages(sessionId string) uint64 {
+	server.mutex.RLock()
+	defer server.mutex.RUnlock()
+	if server.ChanMap[sessionId] == nil {
+		return 0
 	}
+	return server.ChanMap[sessionId].DroppedMessages.Load()
 }